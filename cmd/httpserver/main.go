@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
@@ -11,106 +12,134 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/Skorgum/httpfromtcp/internal/accesslog"
 	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/Skorgum/httpfromtcp/internal/middleware"
 	"github.com/Skorgum/httpfromtcp/internal/request"
 	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/Skorgum/httpfromtcp/internal/router"
 	"github.com/Skorgum/httpfromtcp/internal/server"
 )
 
-const port = 42069
+const (
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
+)
 
 func main() {
-	srv, err := server.Serve(port, handler)
+	rt := router.New()
+	rt.Handle("GET", "/httpbin/{path...}", httpbinHandler)
+	rt.Handle("GET", "/yourproblem", yourProblemHandler)
+	rt.Handle("GET", "/myproblem", myProblemHandler)
+	rt.Handle("GET", "/video", videoHandler)
+	rt.Handle("GET", "/{path...}", defaultHandler)
+
+	handler := middleware.Chain(rt.Handler(),
+		middleware.Recover(nil),
+		middleware.RequestID(),
+		middleware.Timing(),
+	)
+
+	srv, err := server.Serve(port, handler, server.WithAccessLog(accesslog.Combined(os.Stdout)))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer srv.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Error during shutdown:", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
 
-func handler(w *response.Writer, req *request.Request) {
-	target := req.RequestLine.RequestTarget
-
-	if strings.HasPrefix(target, "/httpbin/") {
-		path := strings.TrimPrefix(target, "/httpbin")
-		upstreamURL := "https://httpbin.org" + path
+func httpbinHandler(w *response.Writer, req *request.Request) {
+	upstreamURL := "https://httpbin.org" + strings.TrimPrefix(req.Target.RawPath, "/httpbin")
+	if req.Target.RawQuery != "" {
+		upstreamURL += "?" + req.Target.RawQuery
+	}
 
-		res, err := http.Get(upstreamURL)
-		if err != nil {
-			log.Println("Something went wrong:", err)
-			return
-		}
-		defer res.Body.Close()
+	res, err := http.Get(upstreamURL)
+	if err != nil {
+		log.Println("Something went wrong:", err)
+		w.SetStatus(response.StatusBadGateway)
+		w.Header().Override("Content-Type", "text/plain")
+		w.Write([]byte("bad gateway"))
+		return
+	}
+	defer res.Body.Close()
 
-		w.WriteStatusLine(response.StatusOk)
+	w.WriteStatusLine(response.StatusOk)
 
-		h := response.GetDefaultHeaders(0)
-		delete(h, "Content-Length")
-		h.Override("Transfer-Encoding", "chunked")
-		h.Override("Content-Type", res.Header.Get("Content-Type"))
-		h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
+	h := response.GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Content-Type", res.Header.Get("Content-Type"))
+	h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
 
-		w.WriteHeaders(h)
+	w.WriteHeaders(h)
 
-		buf := make([]byte, 1024)
-		var fullBody []byte
+	buf := make([]byte, 1024)
+	var fullBody []byte
 
-		for {
-			n, err := res.Body.Read(buf)
-			if n > 0 {
-				chunk := buf[:n]
-				fullBody = append(fullBody, chunk...)
+	for {
+		n, err := res.Body.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			fullBody = append(fullBody, chunk...)
 
-				if _, werr := w.WriteChunkedBody(chunk); werr != nil {
-					log.Println("error writing chunk:", werr)
-					return
-				}
-			}
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Println("error reading upstream:", err)
+			if _, werr := w.WriteChunkedBody(chunk); werr != nil {
+				log.Println("error writing chunk:", werr)
 				return
 			}
 		}
-
-		//log.Println("fullBody length:", len(fullBody)) //Testing
-
-		if _, err := w.WriteChunkedBodyDone(); err != nil {
-			log.Println("error finishing chunked body:", err)
-			return
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the 200 is already out; drop the connection so the client
+			// doesn't take the partial body as complete
+			log.Println("error reading upstream:", err)
+			panic(server.ErrAbortHandler)
 		}
+	}
 
-		sum := sha256.Sum256(fullBody)
-		hashHex := hex.EncodeToString(sum[:])
-		lenghStr := strconv.Itoa(len(fullBody))
+	//log.Println("fullBody length:", len(fullBody)) //Testing
 
-		trailers := headers.Headers{
-			"X-Content-SHA256": hashHex,
-			"X-Content-Length": lenghStr,
-		}
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		log.Println("error finishing chunked body:", err)
+		return
+	}
 
-		//log.Println("hashHex:", hashHex, "lenStr:", lenghStr) //Testing
-		//log.Printf("trailers: %#v\n", trailers)               //Testing
+	sum := sha256.Sum256(fullBody)
+	hashHex := hex.EncodeToString(sum[:])
+	lenghStr := strconv.Itoa(len(fullBody))
 
-		if err := w.WriteTrailers(trailers); err != nil {
-			log.Println("error writing trailers:", err)
-			return
-		}
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Content-SHA256", hashHex)
+	trailers.Override("X-Content-Length", lenghStr)
 
+	//log.Println("hashHex:", hashHex, "lenStr:", lenghStr) //Testing
+	//log.Printf("trailers: %#v\n", trailers)               //Testing
+
+	if err := w.WriteTrailers(trailers); err != nil {
+		log.Println("error writing trailers:", err)
 		return
 	}
+}
 
-	switch target {
-	case "/yourproblem":
-		body := []byte(`<html>
+func yourProblemHandler(w *response.Writer, _ *request.Request) {
+	w.SetStatus(response.StatusBadRequest)
+	w.Header().Override("Content-Type", "text/html")
+	w.Write([]byte(`<html>
 	<head>
 		<title>400 Bad Request</title>
 	</head>
@@ -119,18 +148,13 @@ func handler(w *response.Writer, req *request.Request) {
 		<p>Your request honestly kinda sucked.</p>
 	</body>
 </html>
-`)
-
-		w.WriteStatusLine(response.StatusBadRequest)
-
-		h := response.GetDefaultHeaders(len(body))
-		h.Override("Content-Type", "text/html")
-
-		w.WriteHeaders(h)
-		w.WriteBody(body)
+`))
+}
 
-	case "/myproblem":
-		body := []byte(`
+func myProblemHandler(w *response.Writer, _ *request.Request) {
+	w.SetStatus(response.StatusInternalServerError)
+	w.Header().Override("Content-Type", "text/html")
+	w.Write([]byte(`
 		<html>
   <head>
     <title>500 Internal Server Error</title>
@@ -140,39 +164,28 @@ func handler(w *response.Writer, req *request.Request) {
     <p>Okay, you know what? This one is on me.</p>
   </body>
 </html>
-`)
-
-		w.WriteStatusLine(response.StatusInternalServerError)
-
-		h := response.GetDefaultHeaders(len(body))
-		h.Override("Content-Type", "text/html")
-
-		w.WriteHeaders(h)
-		w.WriteBody(body)
-
-	case "/video":
-		data, err := os.ReadFile("assets/vim.mp4")
-		if err != nil {
-			log.Println("Something went wrong", err)
-			w.WriteStatusLine(response.StatusInternalServerError)
-
-			body := []byte("internal server error")
-			h := response.GetDefaultHeaders(len(body))
-			h.Override("Content-Type", "text/plain")
-			w.WriteHeaders(h)
-			w.WriteBody(body)
-			return
-		}
+`))
+}
 
-		w.WriteStatusLine(response.StatusOk)
+func videoHandler(w *response.Writer, _ *request.Request) {
+	data, err := os.ReadFile("assets/vim.mp4")
+	if err != nil {
+		log.Println("Something went wrong", err)
+		w.SetStatus(response.StatusInternalServerError)
+		w.Header().Override("Content-Type", "text/plain")
+		w.Write([]byte("internal server error"))
+		return
+	}
 
-		h := response.GetDefaultHeaders(len(data))
-		h.Override("Content-Type", "video/mp4")
-		w.WriteHeaders(h)
-		w.WriteBody(data)
+	w.Header().Override("Content-Type", "video/mp4")
+	w.Header().Override("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
 
-	default:
-		body := []byte(`
+func defaultHandler(w *response.Writer, _ *request.Request) {
+	w.SetStatus(response.StatusOk)
+	w.Header().Override("Content-Type", "text/html")
+	w.Write([]byte(`
 		<html>
   <head>
     <title>200 OK</title>
@@ -182,14 +195,5 @@ func handler(w *response.Writer, req *request.Request) {
     <p>Your request was an absolute banger.</p>
   </body>
 </html>
-`)
-
-		w.WriteStatusLine(response.StatusOk)
-
-		h := response.GetDefaultHeaders(len(body))
-		h.Override("Content-Type", "text/html")
-
-		w.WriteHeaders(h)
-		w.WriteBody(body)
-	}
+`))
 }
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"sort"
 
 	"github.com/Skorgum/httpfromtcp/internal/request"
 )
@@ -36,13 +35,8 @@ func main() {
 		fmt.Printf("- Target: %s\n", req.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", req.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		keys := make([]string, 0, len(req.Headers))
-		for k := range req.Headers {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		for _, k := range keys {
-			fmt.Printf("- %s: %s\n", k, req.Headers[k])
+		for k, v := range req.Headers.All() {
+			fmt.Printf("- %s: %s\n", k, v)
 		}
 		fmt.Println("Body:")
 		fmt.Println(string(req.Body))
@@ -0,0 +1,140 @@
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry describes one served request. Method, Target and Proto are empty
+// for a request that could not be parsed.
+type Entry struct {
+	Time       time.Time // when the request started
+	RemoteAddr string
+	Method     string
+	Target     string
+	Proto      string // e.g. "HTTP/1.1"
+	Status     int
+	Bytes      int // body bytes sent
+	Duration   time.Duration
+	UserAgent  string
+	Referer    string
+}
+
+type Logger interface {
+	Log(e Entry)
+}
+
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+type textLogger struct {
+	mu       sync.Mutex
+	w        io.Writer
+	combined bool
+}
+
+// Common writes entries to w in the Common Log Format:
+//
+//	127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326
+func Common(w io.Writer) Logger {
+	return &textLogger{w: w}
+}
+
+// Combined writes entries to w in the Combined Log Format, which is Common
+// followed by the quoted Referer and User-Agent.
+func Combined(w io.Writer) Logger {
+	return &textLogger{w: w, combined: true}
+}
+
+func (l *textLogger) Log(e Entry) {
+	requestLine := "-"
+	if e.Method != "" {
+		requestLine = e.Method + " " + e.Target + " " + e.Proto
+	}
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.Itoa(e.Bytes)
+	}
+
+	line := fmt.Sprintf("%s - - [%s] \"%s\" %d %s",
+		host(e.RemoteAddr), e.Time.Format(clfTime), escape(requestLine), e.Status, bytes)
+	if l.combined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", orDash(escape(e.Referer)), orDash(escape(e.UserAgent)))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, line+"\n")
+}
+
+// host strips the port from a TCP address; other addresses, such as Unix
+// socket peers, have nothing useful to show.
+func host(addr string) string {
+	h, _, err := net.SplitHostPort(addr)
+	if err != nil || h == "" {
+		return "-"
+	}
+	return h
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape keeps client-supplied text from breaking out of its quotes or
+// forging log lines, the way Apache does: quotes and backslashes are
+// backslash-escaped and other bytes outside printable ASCII become \xHH.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// JSON writes entries to w as JSON objects, one per line.
+func JSON(w io.Writer) Logger {
+	return Slog(slog.New(slog.NewJSONHandler(w, nil)))
+}
+
+// Slog sends entries to l as "request" records at info level, with one
+// attribute per field.
+func Slog(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+func (l slogLogger) Log(e Entry) {
+	l.l.LogAttrs(context.Background(), slog.LevelInfo, "request",
+		slog.Time("start", e.Time),
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("method", e.Method),
+		slog.String("target", e.Target),
+		slog.String("proto", e.Proto),
+		slog.Int("status", e.Status),
+		slog.Int("bytes", e.Bytes),
+		slog.Duration("duration", e.Duration),
+		slog.String("user_agent", e.UserAgent),
+		slog.String("referer", e.Referer),
+	)
+}
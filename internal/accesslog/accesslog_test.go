@@ -0,0 +1,66 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var entry = Entry{
+	Time:       time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+	RemoteAddr: "127.0.0.1:52000",
+	Method:     "GET",
+	Target:     "/apache_pb.gif",
+	Proto:      "HTTP/1.0",
+	Status:     200,
+	Bytes:      2326,
+	Duration:   1500 * time.Microsecond,
+	UserAgent:  "Mozilla/4.08 [en] (Win98; I ;Nav)",
+	Referer:    "http://www.example.com/start.html",
+}
+
+func TestCommon(t *testing.T) {
+	var buf bytes.Buffer
+	Common(&buf).Log(entry)
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`+"\n", buf.String())
+}
+
+func TestCombined(t *testing.T) {
+	var buf bytes.Buffer
+	Combined(&buf).Log(entry)
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 `+
+		`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`+"\n", buf.String())
+}
+
+func TestCombined_EscapesAndDefaults(t *testing.T) {
+	var buf bytes.Buffer
+	Combined(&buf).Log(Entry{
+		Time:       entry.Time,
+		RemoteAddr: "@",
+		Status:     400,
+		UserAgent:  "evil\" \n127.0.0.1 - - forged",
+	})
+	assert.Equal(t, `- - - [10/Oct/2000:13:55:36 -0700] "-" 400 - "-" "evil\" \x0a127.0.0.1 - - forged"`+"\n", buf.String())
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	JSON(&buf).Log(entry)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "request", got["msg"])
+	assert.Equal(t, "127.0.0.1:52000", got["remote_addr"])
+	assert.Equal(t, "GET", got["method"])
+	assert.Equal(t, "/apache_pb.gif", got["target"])
+	assert.Equal(t, "HTTP/1.0", got["proto"])
+	assert.Equal(t, float64(200), got["status"])
+	assert.Equal(t, float64(2326), got["bytes"])
+	assert.Equal(t, float64(entry.Duration), got["duration"])
+	assert.Equal(t, entry.UserAgent, got["user_agent"])
+	assert.Equal(t, entry.Referer, got["referer"])
+}
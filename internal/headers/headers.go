@@ -2,18 +2,64 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"iter"
+	"slices"
 	"strings"
 )
 
-type Headers map[string]string
+type field struct {
+	name   string
+	values []string
+}
+
+// Headers is an ordered list of header fields. Lookups ignore case, while
+// names are written out in canonical form in the order they were first set.
+// A field keeps each value it was given separately, so repeated field lines
+// such as Set-Cookie survive a round trip.
+type Headers struct {
+	fields []field
+}
 
-func (h Headers) Override(key, value string) {
-	h[key] = value
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
-func NewHeaders() Headers {
-	return make(map[string]string)
+// CanonicalKey upper-cases the first letter of each hyphen-separated word of
+// key and leaves the rest alone, so "content-type" becomes "Content-Type"
+// while "X-Content-SHA256" keeps its casing.
+func CanonicalKey(key string) string {
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		if upper && c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+func (h *Headers) index(key string) int {
+	if h == nil {
+		return -1
+	}
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Override replaces all values of key with value.
+func (h *Headers) Override(key, value string) {
+	if i := h.index(key); i >= 0 {
+		h.fields[i].values = []string{value}
+		return
+	}
+	h.fields = append(h.fields, field{name: CanonicalKey(key), values: []string{value}})
 }
 
 var tokenChars = []byte{'!', '#', '$', '%', '&', '\'', '*', '+', '-', '.', '^', '_', '`', '|', '~'}
@@ -42,7 +88,60 @@ func validTokens(data []byte) bool {
 	return true
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+var (
+	ErrObsFold               = errors.New("header field line starts with whitespace")
+	ErrMissingColon          = errors.New("header field line has no colon")
+	ErrWhitespaceBeforeColon = errors.New("whitespace between header name and colon")
+)
+
+type InvalidFieldNameError struct {
+	Name string
+}
+
+func (e *InvalidFieldNameError) Error() string {
+	return fmt.Sprintf("invalid header name: %q", e.Name)
+}
+
+type InvalidFieldValueError struct {
+	Name  string
+	Value string
+}
+
+func (e *InvalidFieldValueError) Error() string {
+	return fmt.Sprintf("invalid value for header %s: %q", e.Name, e.Value)
+}
+
+func ValidFieldName(name string) bool {
+	return name != "" && validTokens([]byte(name))
+}
+
+// ValidFieldValue reports whether v is a legal field value per RFC 9110 §5.5:
+// visible characters, obs-text, spaces and tabs, but no CR, LF, NUL or other
+// control characters that could end the field line early.
+func ValidFieldValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks every field name and value, so nothing a handler copied
+// from user input can split the message when written.
+func (h *Headers) Validate() error {
+	for name, value := range h.All() {
+		if !ValidFieldName(name) {
+			return &InvalidFieldNameError{Name: name}
+		}
+		if !ValidFieldValue(value) {
+			return &InvalidFieldValueError{Name: name, Value: value}
+		}
+	}
+	return nil
+}
+
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
 		return 0, false, nil
@@ -52,37 +151,98 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 2, true, nil
 	}
 
+	// a line starting with whitespace is either a continuation of the
+	// previous field (obs-fold) or whitespace before the first one; peers
+	// disagree on what either means, so both are rejected (RFC 9112 §2.2, §5.2)
+	if data[0] == ' ' || data[0] == '\t' {
+		return 0, false, ErrObsFold
+	}
+
 	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
+	if len(parts) != 2 {
+		return 0, false, fmt.Errorf("%w: %q", ErrMissingColon, data[:idx])
+	}
 	rawKey := string(parts[0])
-	if rawKey != strings.TrimRight(rawKey, " ") {
-		return 0, false, fmt.Errorf("invalid header name: %s", rawKey)
+	if rawKey != strings.TrimRight(rawKey, " \t") {
+		return 0, false, fmt.Errorf("%w: %q", ErrWhitespaceBeforeColon, rawKey)
 	}
 	key := string(bytes.TrimSpace(parts[0]))
-	if !validTokens([]byte(key)) {
-		return 0, false, fmt.Errorf("invalid header token found: %s", key)
+	if !ValidFieldName(key) {
+		return 0, false, &InvalidFieldNameError{Name: key}
 	}
-	key = strings.ToLower(key)
 
-	value := string(bytes.TrimSpace(parts[1]))
+	value := string(bytes.Trim(parts[1], " \t"))
+	if !ValidFieldValue(value) {
+		return 0, false, &InvalidFieldValueError{Name: key, Value: value}
+	}
 
-	h.Set(key, value)
+	h.Add(key, value)
 
 	return idx + 2, false, nil
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	if existing, ok := h[key]; ok {
-		h[key] = existing + ", " + value
-	} else {
-		h[key] = value
+// Add appends value to key, keeping any values it already has.
+func (h *Headers) Add(key, value string) {
+	if i := h.index(key); i >= 0 {
+		h.fields[i].values = append(h.fields[i].values, value)
+		return
 	}
+	h.fields = append(h.fields, field{name: CanonicalKey(key), values: []string{value}})
 }
 
-func (h Headers) Get(key string) string {
-	key = strings.ToLower(key)
-	if value, ok := h[key]; ok {
-		return value
+// Get returns the combined field value, with multiple values joined by ", "
+// as RFC 9110 §5.3 allows for list-based fields.
+func (h *Headers) Get(key string) string {
+	if i := h.index(key); i >= 0 {
+		return strings.Join(h.fields[i].values, ", ")
 	}
 	return ""
 }
+
+func (h *Headers) Values(key string) []string {
+	if i := h.index(key); i >= 0 {
+		return slices.Clone(h.fields[i].values)
+	}
+	return nil
+}
+
+func (h *Headers) Del(key string) {
+	if i := h.index(key); i >= 0 {
+		h.fields = append(h.fields[:i], h.fields[i+1:]...)
+	}
+}
+
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All yields a canonical name and value for every field line, in insertion
+// order; a field with several values yields each one separately.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			for _, v := range f.values {
+				if !yield(f.name, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// HasToken reports whether the comma-separated list in key contains token,
+// compared case-insensitively (e.g. "Connection: keep-alive, close").
+func (h *Headers) HasToken(key, token string) bool {
+	for _, v := range strings.Split(h.Get(key), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
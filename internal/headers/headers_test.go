@@ -13,7 +13,7 @@ func TestValidSingleHeader(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 }
@@ -29,13 +29,18 @@ func TestInvalidSpacingHeader(t *testing.T) {
 
 func TestSingleHeaderWithExtraWhitespace(t *testing.T) {
 	headers := NewHeaders()
-	data := []byte("                Host:     localhost:42069                       \r\n\r\n")
+	data := []byte("Host:     localhost:42069                       \r\n\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, 66, n)
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
+	assert.Equal(t, 50, n)
 	assert.False(t, done)
+
+	// whitespace before the name is rejected, even on the first line
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("                Host: localhost:42069\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrObsFold)
 }
 
 func TestValidTwoHeadersWithExistingHeaders(t *testing.T) {
@@ -45,14 +50,14 @@ func TestValidTwoHeadersWithExistingHeaders(t *testing.T) {
 	n1, done1, err1 := headers.Parse(data)
 	require.NoError(t, err1)
 	assert.False(t, done1)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n1)
 
 	n2, done2, err2 := headers.Parse(data[n1:])
 	require.NoError(t, err2)
 	assert.False(t, done2)
-	assert.Equal(t, "BootdevClient", headers["user-agent"])
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "BootdevClient", headers.Get("user-agent"))
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 27, n2)
 }
 
@@ -71,7 +76,7 @@ func TestCapitolLettersInHeaderKeys(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headers.Get("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 }
@@ -106,10 +111,156 @@ func TestHeadersWithMultipleValues(t *testing.T) {
 		}
 	}
 
-	actual := headers["set-person"]
+	actual := headers.Get("set-person")
 	expected := "lane-loves-go, prime-loves-zig, tj-loves-ocaml"
 
 	if actual != expected {
 		t.Fatalf("expected %v, got %v", expected, actual)
 	}
 }
+
+func TestHeadersPreserveOrder(t *testing.T) {
+	headers := NewHeaders()
+	data := []byte("Host: localhost\r\naccept: */*\r\nX-Trace-ID: 1\r\n\r\n")
+
+	offset := 0
+	for {
+		n, done, err := headers.Parse(data[offset:])
+		require.NoError(t, err)
+		offset += n
+		if done {
+			break
+		}
+	}
+
+	var names []string
+	for name := range headers.All() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Host", "Accept", "X-Trace-ID"}, names)
+}
+
+func TestCanonicalKey(t *testing.T) {
+	assert.Equal(t, "Content-Type", CanonicalKey("content-type"))
+	assert.Equal(t, "X-Content-SHA256", CanonicalKey("X-Content-SHA256"))
+	assert.Equal(t, "X-Content-Sha256", CanonicalKey("x-content-sha256"))
+	assert.Equal(t, "ETag", CanonicalKey("ETag"))
+}
+
+func TestHeadersDel(t *testing.T) {
+	headers := NewHeaders()
+	headers.Override("A", "1")
+	headers.Override("B", "2")
+	headers.Override("C", "3")
+	headers.Del("b")
+
+	assert.Equal(t, "", headers.Get("B"))
+	assert.Equal(t, 2, headers.Len())
+	assert.Equal(t, "3", headers.Get("c"))
+}
+
+func TestHeadersMultipleValuesKeptSeparately(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("Set-Cookie", "a=1; Path=/")
+	headers.Add("set-cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	headers.Add("Content-Type", "text/plain")
+
+	assert.Equal(t, []string{"a=1; Path=/", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT"}, headers.Values("SET-COOKIE"))
+	assert.Equal(t, "a=1; Path=/, b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT", headers.Get("Set-Cookie"))
+	assert.Nil(t, headers.Values("X-Missing"))
+
+	var lines []string
+	for name, value := range headers.All() {
+		lines = append(lines, name+": "+value)
+	}
+	assert.Equal(t, []string{
+		"Set-Cookie: a=1; Path=/",
+		"Set-Cookie: b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT",
+		"Content-Type: text/plain",
+	}, lines)
+
+	headers.Override("Set-Cookie", "c=3")
+	assert.Equal(t, []string{"c=3"}, headers.Values("Set-Cookie"))
+
+	headers.Del("set-cookie")
+	assert.Nil(t, headers.Values("Set-Cookie"))
+	assert.Equal(t, 1, headers.Len())
+}
+
+func TestParsedHeadersKeepSeparateValues(t *testing.T) {
+	headers := NewHeaders()
+	data := []byte("Cookie: a=1\r\nCookie: b=2\r\n\r\n")
+
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("cookie"))
+}
+
+func TestParseRejectsControlCharsInValue(t *testing.T) {
+	for _, data := range []string{
+		"X-Foo: a\rb\r\n\r\n",
+		"X-Foo: a\x00b\r\n\r\n",
+		"X-Foo: a\x1bb\r\n\r\n",
+		"X-Foo: a\x7fb\r\n\r\n",
+	} {
+		headers := NewHeaders()
+		_, _, err := headers.Parse([]byte(data))
+		var valueErr *InvalidFieldValueError
+		require.ErrorAs(t, err, &valueErr, "%q", data)
+		assert.Equal(t, "X-Foo", valueErr.Name)
+	}
+
+	// tabs and obs-text are allowed
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Foo: a\tb \xe9\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb \xe9", headers.Get("x-foo"))
+}
+
+func TestHeadersValidate(t *testing.T) {
+	headers := NewHeaders()
+	headers.Add("X-Foo", "bar")
+	require.NoError(t, headers.Validate())
+
+	headers.Add("Location", "/x\r\nSet-Cookie: evil=1")
+	var valueErr *InvalidFieldValueError
+	require.ErrorAs(t, headers.Validate(), &valueErr)
+	assert.Equal(t, "Location", valueErr.Name)
+
+	headers = NewHeaders()
+	headers.Add("Bad Name", "x")
+	var nameErr *InvalidFieldNameError
+	require.ErrorAs(t, headers.Validate(), &nameErr)
+	assert.Equal(t, "Bad Name", nameErr.Name)
+}
+
+func TestParseRejectsObsFold(t *testing.T) {
+	headers := NewHeaders()
+	data := []byte("X-Long: a\r\n\tb\r\n\r\n")
+
+	n, _, err := headers.Parse(data)
+	require.NoError(t, err)
+	_, _, err = headers.Parse(data[n:])
+	assert.ErrorIs(t, err, ErrObsFold)
+}
+
+func TestParseRejectsWhitespaceBeforeColon(t *testing.T) {
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("Host\t: localhost\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrWhitespaceBeforeColon)
+}
+
+func TestParseRejectsMalformedFieldLines(t *testing.T) {
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("foo\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrMissingColon)
+
+	_, _, err = headers.Parse([]byte(": x\r\n\r\n"))
+	var nameErr *InvalidFieldNameError
+	require.ErrorAs(t, err, &nameErr)
+	assert.Empty(t, nameErr.Name)
+	assert.Zero(t, headers.Len())
+}
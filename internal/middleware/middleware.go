@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/Skorgum/httpfromtcp/internal/server"
+)
+
+type Middleware func(server.Handler) server.Handler
+
+// Chain wraps h so that the first middleware is the outermost one, i.e. it
+// sees the request first and the finished response last.
+func Chain(h server.Handler, middlewares ...Middleware) server.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Logger logs one line per request once the handler has returned. A nil
+// logger uses log.Default().
+func Logger(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			logger.Printf("%s %s %d %dB %s",
+				req.RequestLine.Method,
+				req.RequestLine.RequestTarget,
+				w.StatusCode(),
+				w.BytesWritten(),
+				time.Since(start),
+			)
+		}
+	}
+}
+
+// Recover turns a handler panic into a 500 response. If part of the response
+// has already gone out it panics again with server.ErrAbortHandler, so the
+// server drops the connection instead of finishing the response.
+func Recover(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == server.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.Printf("panic serving %s %s: %v\n%s",
+					req.RequestLine.Method, req.RequestLine.RequestTarget, rec, debug.Stack())
+
+				if !w.Reset() {
+					panic(server.ErrAbortHandler)
+				}
+				body := []byte("internal server error")
+				w.WriteStatusLine(response.StatusInternalServerError)
+				h := response.GetDefaultHeaders(len(body))
+				h.Override("Content-Type", "text/plain")
+				w.WriteHeaders(h)
+				w.WriteBody(body)
+			}()
+			next(w, req)
+		}
+	}
+}
+
+const requestIDHeader = "X-Request-Id"
+
+// RequestID makes sure every request carries an X-Request-Id header,
+// generating one if the client didn't send it, and echoes it on the response.
+func RequestID() Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			id := req.Headers.Get(requestIDHeader)
+			if id == "" {
+				id = newRequestID()
+				req.Headers.Override(requestIDHeader, id)
+			}
+			w.OnWriteHeaders(func(h *headers.Headers) {
+				h.Override(requestIDHeader, id)
+			})
+			next(w, req)
+		}
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Timing adds a Server-Timing header with the time the handler took to get
+// to writing its headers.
+func Timing() Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			w.OnWriteHeaders(func(h *headers.Headers) {
+				elapsed := float64(time.Since(start).Microseconds()) / 1000
+				h.Override("Server-Timing", fmt.Sprintf("app;dur=%.3f", elapsed))
+			})
+			next(w, req)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/Skorgum/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, h server.Handler, raw string) (*request.Request, *http.Response, string) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	h(response.NewWriter(&buf), req)
+
+	res, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return req, res, string(body)
+}
+
+func ok(w *response.Writer, _ *request.Request) {
+	body := []byte("ok")
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	mark := func(name string) Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" in")
+				next(w, req)
+				calls = append(calls, name+" out")
+			}
+		}
+	}
+
+	h := Chain(ok, mark("a"), mark("b"))
+	run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, []string{"a in", "b in", "b out", "a out"}, calls)
+}
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	h := Chain(ok, Logger(log.New(&out, "", 0)))
+
+	run(t, h, "GET /logged HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out.String(), "GET /logged 200 2B "), out.String())
+}
+
+func TestRecover(t *testing.T) {
+	var out bytes.Buffer
+	h := Chain(func(*response.Writer, *request.Request) {
+		panic("boom")
+	}, Recover(log.New(&out, "", 0)))
+
+	_, res, body := run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Equal(t, "internal server error", body)
+	assert.Contains(t, out.String(), "panic serving GET /: boom")
+}
+
+func TestRecover_AfterBodyStartedAbortsConnection(t *testing.T) {
+	h := Chain(func(w *response.Writer, _ *request.Request) {
+		// past the writer's buffer, so the head and a chunk are already out
+		w.Write(bytes.Repeat([]byte("a"), 5000))
+		panic("boom")
+	}, Recover(log.New(io.Discard, "", 0)))
+
+	srv, err := server.Serve(0, h)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	_, err = io.ReadAll(res.Body)
+	assert.Error(t, err)
+}
+
+func TestRecover_PassesAbortThrough(t *testing.T) {
+	var out bytes.Buffer
+	h := Chain(func(*response.Writer, *request.Request) {
+		panic(server.ErrAbortHandler)
+	}, Recover(log.New(&out, "", 0)))
+
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.PanicsWithValue(t, server.ErrAbortHandler, func() {
+		h(response.NewWriter(io.Discard), req)
+	})
+	assert.Empty(t, out.String())
+}
+
+func TestRequestID(t *testing.T) {
+	h := Chain(ok, RequestID())
+
+	req, res, _ := run(t, h, "GET / HTTP/1.1\r\n\r\n")
+	id := res.Header.Get("X-Request-Id")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, req.Headers.Get("X-Request-Id"))
+
+	_, res, _ = run(t, h, "GET / HTTP/1.1\r\nX-Request-Id: abc-123\r\n\r\n")
+	assert.Equal(t, "abc-123", res.Header.Get("X-Request-Id"))
+}
+
+func TestTiming(t *testing.T) {
+	_, res, _ := run(t, Chain(ok, Timing()), "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(res.Header.Get("Server-Timing"), "app;dur="))
+}
@@ -0,0 +1,132 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxDrain is how much unread body Close will discard to keep the
+// connection usable for the next request.
+const maxDrain = 256 << 10
+
+var (
+	ErrBodyClosed     = errors.New("read on closed request body")
+	ErrBodyNotDrained = errors.New("request body too large to drain")
+)
+
+type body struct {
+	req    *Request
+	closed bool
+	err    error // first read error, returned by every later read
+}
+
+// BodyReader returns the request body. For a streamed request the bytes are
+// decoded from the connection as they are read.
+func (r *Request) BodyReader() io.ReadCloser {
+	if r.bodyBuffered || r.src == nil {
+		return io.NopCloser(bytes.NewReader(r.Body))
+	}
+	if r.body == nil {
+		r.body = &body{req: r}
+	}
+	return r.body
+}
+
+// ReadBody reads the rest of the body into Body and returns it.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.bodyBuffered {
+		return r.Body, nil
+	}
+
+	data, err := io.ReadAll(r.BodyReader())
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = append(r.Body, data...)
+	r.bodyBuffered = true
+	return r.Body, nil
+}
+
+// BodyErr returns the error that stopped reading the body, such as
+// ErrBodyTooLarge, or nil if reading it has not failed.
+func (r *Request) BodyErr() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.err
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *body) read(p []byte) (int, error) {
+	r := b.req
+	if err := r.Continue(); err != nil {
+		return 0, err
+	}
+	for len(r.pending) == 0 && r.state != stateDone {
+		if err := r.src.parseBuffered(r); err != nil {
+			return 0, err
+		}
+		if len(r.pending) > 0 || r.state == stateDone {
+			break
+		}
+
+		if err := r.src.fill(); err != nil {
+			if err == io.EOF {
+				return 0, ErrIncompleteRequest
+			}
+			return 0, err
+		}
+	}
+
+	if len(r.pending) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	if len(r.pending) == 0 {
+		r.pending = nil
+	}
+	return n, nil
+}
+
+// Close discards whatever is left of the body so the next request on the
+// connection can be read, and fails if more than maxDrain bytes remain.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	// the client never got 100 Continue, so it may or may not send the body;
+	// the connection can't be reused either way
+	if b.req.expectContinue {
+		b.closed = true
+		return fmt.Errorf("%w: client is waiting for 100 Continue", ErrBodyNotDrained)
+	}
+
+	_, err := io.CopyN(io.Discard, b, maxDrain)
+	b.closed = true
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if b.req.state != stateDone || len(b.req.pending) > 0 {
+		return ErrBodyNotDrained
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package request
+
+import "errors"
+
+// Errors returned while reading a request, alongside the limit and framing
+// errors in limits.go and framing.go. They are wrapped with detail, so match
+// them with errors.Is.
+var (
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	ErrUnsupportedVersion   = errors.New("unsupported HTTP version")
+	ErrMalformedHeader      = errors.New("malformed header field")
+	ErrMalformedChunk       = errors.New("malformed chunked body")
+	ErrTimeout              = errors.New("timed out reading request")
+)
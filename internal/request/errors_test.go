@@ -0,0 +1,46 @@
+package request
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+)
+
+type deadlineReader struct{}
+
+func (deadlineReader) Read([]byte) (int, error) {
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestErrors_RequestLine(t *testing.T) {
+	for raw, want := range map[string]error{
+		"GET /\r\n\r\n":                         ErrMalformedRequestLine,
+		"GET  / HTTP/1.1\r\n\r\n":               ErrMalformedRequestLine,
+		"get / HTTP/1.1\r\n\r\n":                ErrMalformedRequestLine,
+		"GET / HTTP/11\r\n\r\n":                 ErrMalformedRequestLine,
+		"GET / HTTPS/1.1\r\n\r\n":               ErrMalformedRequestLine,
+		"GET / HTTP/2.0\r\n\r\n":                ErrUnsupportedVersion,
+		"GET /a#b HTTP/1.1\r\n\r\n":             ErrInvalidTarget,
+		"GET / HTTP/1.1\r\nBad Name: x\r\n\r\n": ErrMalformedHeader,
+	} {
+		_, err := parse(raw)
+		assert.ErrorIs(t, err, want, raw)
+	}
+}
+
+func TestErrors_WrapCause(t *testing.T) {
+	_, err := parse("GET / HTTP/1.1\r\nHost : x\r\n\r\n")
+	assert.ErrorIs(t, err, ErrMalformedHeader)
+	assert.ErrorIs(t, err, headers.ErrWhitespaceBeforeColon)
+
+	_, err = parse("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n")
+	assert.ErrorIs(t, err, ErrMalformedChunk)
+}
+
+func TestErrors_Timeout(t *testing.T) {
+	_, err := RequestFromReader(deadlineReader{})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
@@ -0,0 +1,49 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrExpectationFailed = errors.New("unsupported expectation")
+
+// checkExpect handles the Expect header once the body framing is known. Only
+// 100-continue is understood, and only HTTP/1.1 clients may send it.
+func (r *Request) checkExpect() error {
+	expect := r.Headers.Get("expect")
+	if expect == "" || r.HTTP10() {
+		return nil
+	}
+	if !strings.EqualFold(strings.TrimSpace(expect), "100-continue") {
+		return fmt.Errorf("%w: %q", ErrExpectationFailed, expect)
+	}
+	// without a body there is nothing for the client to hold back
+	r.expectContinue = r.state != stateDone
+	return nil
+}
+
+// ExpectsContinue reports whether the client is holding back the body until
+// it sees 100 Continue. A handler can check it to reject the upload up front.
+func (r *Request) ExpectsContinue() bool {
+	return r.expectContinue
+}
+
+// OnContinue sets the function that sends 100 Continue. It runs at most once,
+// when the body is first read or Continue is called.
+func (r *Request) OnContinue(fn func() error) {
+	r.continueFn = fn
+}
+
+// Continue tells a waiting client to send the body. It does nothing if the
+// client is not waiting.
+func (r *Request) Continue() error {
+	if !r.expectContinue {
+		return nil
+	}
+	r.expectContinue = false
+	if r.continueFn == nil {
+		return nil
+	}
+	return r.continueFn()
+}
@@ -0,0 +1,56 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpect_ContinueOnFirstRead(t *testing.T) {
+	req, err := NewReader(strings.NewReader("POST / HTTP/1.1\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\nhello")).StreamRequest()
+	require.NoError(t, err)
+	assert.True(t, req.ExpectsContinue())
+
+	calls := 0
+	req.OnContinue(func() error {
+		calls++
+		return nil
+	})
+
+	body, err := io.ReadAll(req.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, 1, calls)
+	assert.False(t, req.ExpectsContinue())
+}
+
+func TestExpect_CloseWithoutReading(t *testing.T) {
+	req, err := NewReader(strings.NewReader("PUT / HTTP/1.1\r\nExpect: 100-Continue\r\nContent-Length: 5\r\n\r\n")).StreamRequest()
+	require.NoError(t, err)
+	req.OnContinue(func() error {
+		t.Fatal("100 Continue sent for a body nobody read")
+		return nil
+	})
+
+	assert.ErrorIs(t, req.BodyReader().Close(), ErrBodyNotDrained)
+}
+
+func TestExpect_Ignored(t *testing.T) {
+	// nothing to hold back
+	req, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nExpect: 100-continue\r\n\r\n"))
+	require.NoError(t, err)
+	assert.False(t, req.ExpectsContinue())
+
+	// HTTP/1.0 clients can't wait for an interim response
+	req, err = NewReader(strings.NewReader("POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 1\r\n\r\nx")).StreamRequest()
+	require.NoError(t, err)
+	assert.False(t, req.ExpectsContinue())
+}
+
+func TestExpect_Unsupported(t *testing.T) {
+	_, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nExpect: 200-ok\r\nContent-Length: 1\r\n\r\nx"))
+	assert.ErrorIs(t, err, ErrExpectationFailed)
+}
@@ -0,0 +1,78 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+)
+
+// Errors for requests whose body length is ambiguous (RFC 9112 §6.3). Each
+// one is a way for a proxy and this server to disagree on where the body ends,
+// so they are rejected rather than guessed at.
+var (
+	ErrConflictingContentLength  = errors.New("conflicting Content-Length values")
+	ErrInvalidContentLength      = errors.New("invalid Content-Length")
+	ErrAmbiguousFraming          = errors.New("both Transfer-Encoding and Content-Length present")
+	ErrInvalidTransferEncoding   = errors.New("invalid Transfer-Encoding")
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+)
+
+// contentLength returns the declared body length, or -1 if there is none.
+// Repeated fields or list members are allowed only if they all agree.
+func contentLength(h *headers.Headers) (int, error) {
+	length := -1
+	for _, field := range h.Values("content-length") {
+		for _, v := range strings.Split(field, ",") {
+			v = strings.TrimSpace(v)
+			if !isDigits(v) {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, field)
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, field)
+			}
+			if length >= 0 && n != length {
+				return 0, fmt.Errorf("%w: %d and %d", ErrConflictingContentLength, length, n)
+			}
+			length = n
+		}
+	}
+	return length, nil
+}
+
+// checkTransferEncoding accepts chunked as the one and only coding, the only
+// one the parser can decode.
+func checkTransferEncoding(h *headers.Headers) error {
+	var codings []string
+	for _, field := range h.Values("transfer-encoding") {
+		for _, c := range strings.Split(field, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				codings = append(codings, c)
+			}
+		}
+	}
+	for _, c := range codings {
+		if !strings.EqualFold(c, "chunked") {
+			return fmt.Errorf("%w: %q", ErrUnsupportedTransferCoding, c)
+		}
+	}
+	if len(codings) != 1 {
+		return fmt.Errorf("%w: chunked must be the only coding, got %q", ErrInvalidTransferEncoding, h.Get("transfer-encoding"))
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(raw string) (*Request, error) {
+	return RequestFromReader(&chunkReader{data: raw, numBytesPerRead: 5})
+}
+
+func TestFraming_ContentLength(t *testing.T) {
+	// identical repeats are the same length said twice
+	r, err := parse("POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	r, err = parse("POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\nhello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	_, err = parse("POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!")
+	assert.ErrorIs(t, err, ErrConflictingContentLength)
+
+	_, err = parse("POST / HTTP/1.1\r\nContent-Length: 5, 6\r\n\r\nhello!")
+	assert.ErrorIs(t, err, ErrConflictingContentLength)
+
+	for _, cl := range []string{"+5", "-1", "5a", "0x5", ""} {
+		_, err = parse("POST / HTTP/1.1\r\nContent-Length: " + cl + "\r\n\r\nhello")
+		assert.ErrorIs(t, err, ErrInvalidContentLength, cl)
+	}
+}
+
+func TestFraming_TransferEncoding(t *testing.T) {
+	_, err := parse("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n0\r\n\r\n")
+	assert.ErrorIs(t, err, ErrAmbiguousFraming)
+
+	_, err = parse("POST / HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.ErrorIs(t, err, ErrAmbiguousFraming)
+
+	for _, te := range []string{"gzip", "gzip, chunked", "chunked, identity"} {
+		_, err = parse("POST / HTTP/1.1\r\nTransfer-Encoding: " + te + "\r\n\r\n0\r\n\r\n")
+		assert.ErrorIs(t, err, ErrUnsupportedTransferCoding, te)
+	}
+
+	_, err = parse("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.ErrorIs(t, err, ErrInvalidTransferEncoding)
+
+	r, err := parse("POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+}
+
+func TestFraming_HeaderLineSyntax(t *testing.T) {
+	_, err := parse("GET / HTTP/1.1\r\nHost : x\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrWhitespaceBeforeColon)
+
+	_, err = parse("GET / HTTP/1.1\r\nHost\t: x\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrWhitespaceBeforeColon)
+
+	_, err = parse("GET / HTTP/1.1\r\nHost: x\r\nX-Long: a\r\n  b\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrObsFold)
+
+	// a space before the first field would hide it from a lenient peer
+	_, err = parse("POST / HTTP/1.1\r\n Content-Length: 3\r\n\r\nabc")
+	assert.ErrorIs(t, err, headers.ErrObsFold)
+
+	_, err = parse("GET / HTTP/1.1\r\nfoo\r\n\r\n")
+	assert.ErrorIs(t, err, headers.ErrMissingColon)
+
+	_, err = parse("GET / HTTP/1.1\r\n: x\r\n\r\n")
+	assert.ErrorIs(t, err, ErrMalformedHeader)
+}
@@ -0,0 +1,74 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+)
+
+// Limits caps how much a single request may make the parser hold. A zero
+// field means no limit.
+type Limits struct {
+	MaxRequestLine int // bytes, excluding CRLF
+	MaxHeaderLine  int // bytes per field line (or chunk-size line), excluding CRLF
+	MaxHeaderBytes int // bytes across all header and trailer lines
+	MaxHeaderCount int // header plus trailer fields
+	MaxBodySize    int // decoded body bytes
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLine: 8 << 10,
+	MaxHeaderLine:  8 << 10,
+	MaxHeaderBytes: 64 << 10,
+	MaxHeaderCount: 100,
+}
+
+var (
+	ErrRequestLineTooLong = errors.New("request line too long")
+	ErrHeaderTooLarge     = errors.New("request header fields too large")
+	ErrBodyTooLarge       = errors.New("request body too large")
+)
+
+func exceeds(n, limit int) bool {
+	return limit > 0 && n > limit
+}
+
+// parseField parses one header or trailer line into h, enforcing the header
+// limits across both sections.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+	n, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %w", ErrMalformedHeader, err)
+	}
+	if n == 0 {
+		if exceeds(len(data), r.limits.MaxHeaderLine) {
+			return 0, false, fmt.Errorf("%w: field line over %d bytes", ErrHeaderTooLarge, r.limits.MaxHeaderLine)
+		}
+		return 0, false, nil
+	}
+	if done {
+		return n, true, nil
+	}
+
+	if exceeds(n-2, r.limits.MaxHeaderLine) {
+		return 0, false, fmt.Errorf("%w: field line over %d bytes", ErrHeaderTooLarge, r.limits.MaxHeaderLine)
+	}
+	r.headerBytes += n
+	if exceeds(r.headerBytes, r.limits.MaxHeaderBytes) {
+		return 0, false, fmt.Errorf("%w: headers over %d bytes", ErrHeaderTooLarge, r.limits.MaxHeaderBytes)
+	}
+	r.headerCount++
+	if exceeds(r.headerCount, r.limits.MaxHeaderCount) {
+		return 0, false, fmt.Errorf("%w: more than %d fields", ErrHeaderTooLarge, r.limits.MaxHeaderCount)
+	}
+	return n, false, nil
+}
+
+func (r *Request) addBodySize(n int) error {
+	r.bodySize += n
+	if exceeds(r.bodySize, r.limits.MaxBodySize) {
+		return fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, r.limits.MaxBodySize)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readWithLimits(raw string, limits Limits) (*Request, error) {
+	reader := NewReader(&chunkReader{data: raw, numBytesPerRead: 16})
+	reader.Limits = limits
+	return reader.ReadRequest()
+}
+
+func TestLimits_RequestLine(t *testing.T) {
+	limits := Limits{MaxRequestLine: 32}
+
+	_, err := readWithLimits("GET /"+strings.Repeat("a", 40)+" HTTP/1.1\r\n\r\n", limits)
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// never terminated, so it is caught before the whole line arrives
+	_, err = readWithLimits("GET /"+strings.Repeat("a", 1000), limits)
+	assert.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	_, err = readWithLimits("GET /short HTTP/1.1\r\n\r\n", limits)
+	assert.NoError(t, err)
+}
+
+func TestLimits_HeaderLine(t *testing.T) {
+	limits := Limits{MaxHeaderLine: 20}
+
+	_, err := readWithLimits("GET / HTTP/1.1\r\nX-Long: "+strings.Repeat("v", 30)+"\r\n\r\n", limits)
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	_, err = readWithLimits("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", limits)
+	assert.NoError(t, err)
+}
+
+func TestLimits_HeaderBytesAndCount(t *testing.T) {
+	raw := "GET / HTTP/1.1\r\n" + strings.Repeat("X-A: b\r\n", 10) + "\r\n"
+
+	_, err := readWithLimits(raw, Limits{MaxHeaderCount: 9})
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	_, err = readWithLimits(raw, Limits{MaxHeaderBytes: 79})
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	_, err = readWithLimits(raw, Limits{MaxHeaderCount: 10, MaxHeaderBytes: 80})
+	assert.NoError(t, err)
+}
+
+func TestLimits_TrailersCountTowardsHeaders(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"0\r\nX-One: 1\r\nX-Two: 2\r\n\r\n"
+
+	_, err := readWithLimits(raw, Limits{MaxHeaderCount: 2})
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+}
+
+func TestLimits_BodySize(t *testing.T) {
+	limits := Limits{MaxBodySize: 10}
+
+	// Content-Length is rejected before any of the body is read
+	reader := NewReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\n"))
+	reader.Limits = limits
+	_, err := reader.StreamRequest()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	_, err = readWithLimits("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n", limits)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	r, err := readWithLimits("POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\n0123456789", limits)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(r.Body))
+}
@@ -1,8 +1,11 @@
 package request
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 
@@ -15,14 +18,34 @@ const (
 	stateInitialized parseState = iota
 	stateParsingHeaders
 	stateParsingBody
+	stateParsingChunkSize
+	stateParsingChunkData
+	stateParsingChunkEnd
+	stateParsingTrailers
 	stateDone
 )
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
+	Target      Target
+	Headers     *headers.Headers
 	Body        []byte
+	Trailers    *headers.Headers
 	state       parseState
+
+	pathValues     map[string]string
+	limits         Limits
+	headerBytes    int
+	headerCount    int
+	bodySize       int
+	src            *Reader
+	body           *body
+	bodyBuffered   bool
+	pending        []byte
+	bodyRemaining  int
+	chunkRemaining int
+	expectContinue bool
+	continueFn     func() error
 }
 
 type RequestLine struct {
@@ -31,53 +54,121 @@ type RequestLine struct {
 	Method        string
 }
 
-const bufferSize = 8
+const bufferSize = 4096
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
+var ErrIncompleteRequest = errors.New("incomplete request")
 
-	req := &Request{
-		state:   stateInitialized,
-		Headers: headers.NewHeaders(),
+// Reader parses consecutive requests from a single connection, keeping any
+// bytes read past the end of one request for the next.
+type Reader struct {
+	Limits Limits
+
+	r           io.Reader
+	buf         []byte
+	readToIndex int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		r:      r,
+		buf:    make([]byte, bufferSize),
 	}
+}
 
-	for req.state != stateDone {
-		// grow buffer if full
-		if readToIndex == len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf[:readToIndex])
-			buf = newBuf
-		}
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
 
-		n, err := reader.Read(buf[readToIndex:])
-		if n > 0 {
-			readToIndex += n
+// ReadRequest reads a whole request, including its body, into memory. It
+// returns io.EOF if the connection was closed before any byte of the next
+// request arrived.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	req, err := rr.StreamRequest()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := req.ReadBody(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
 
-			consumed, parseErr := req.parse(buf[:readToIndex])
-			if parseErr != nil {
-				return nil, parseErr
-			}
+// StreamRequest returns as soon as the headers are parsed. The body is pulled
+// from the connection on demand through BodyReader, and must be consumed or
+// closed before the next request is read.
+func (rr *Reader) StreamRequest() (*Request, error) {
+	req := &Request{
+		state:    stateInitialized,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		limits:   rr.Limits,
+		src:      rr,
+	}
 
-			if consumed > 0 {
-				copy(buf, buf[consumed:readToIndex])
-				readToIndex -= consumed
-			}
+	for {
+		if err := rr.parseBuffered(req); err != nil {
+			return nil, err
 		}
 
-		if err == io.EOF {
-			break
+		if req.state >= stateParsingBody {
+			return req, nil
 		}
-		if err != nil {
+
+		if err := rr.fill(); err != nil {
+			if err == io.EOF {
+				if req.state == stateInitialized && rr.readToIndex == 0 {
+					return nil, io.EOF
+				}
+				return nil, ErrIncompleteRequest
+			}
 			return nil, err
 		}
 	}
+}
 
-	if req.state != stateDone {
-		return nil, fmt.Errorf("incomplete request")
+// WaitForRequest blocks until at least one byte of the next request has
+// arrived, so callers can tell an idle connection from a slow request.
+func (rr *Reader) WaitForRequest() error {
+	if rr.readToIndex > 0 {
+		return nil
 	}
+	return rr.fill()
+}
 
-	return req, nil
+func (rr *Reader) parseBuffered(req *Request) error {
+	consumed, err := req.parse(rr.buf[:rr.readToIndex])
+	if err != nil {
+		return err
+	}
+	rr.discard(consumed)
+	return nil
+}
+
+func (rr *Reader) fill() error {
+	// grow buffer if full
+	if rr.readToIndex == len(rr.buf) {
+		newBuf := make([]byte, len(rr.buf)*2)
+		copy(newBuf, rr.buf[:rr.readToIndex])
+		rr.buf = newBuf
+	}
+
+	n, err := rr.r.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += n
+	if n > 0 {
+		return nil
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+func (rr *Reader) discard(n int) {
+	if n > 0 {
+		copy(rr.buf, rr.buf[n:rr.readToIndex])
+		rr.readToIndex -= n
+	}
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -88,30 +179,31 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 		return nil, 0, nil
 	}
 
-	parts := strings.Split(requestString[:idx], " ")
+	line := requestString[:idx]
+	parts := strings.Split(line, " ")
 	if len(parts) != 3 {
-		return nil, 0, fmt.Errorf("Invalid format")
-	}
-
-	version := strings.Split(parts[2], "/")
-	if len(version) != 2 {
-		return nil, 0, fmt.Errorf("Invalid format")
-	}
-
-	if version[1] != "1.1" {
-		return nil, 0, fmt.Errorf("Unsupported HTML type")
+		return nil, 0, fmt.Errorf("%w: %q", ErrMalformedRequestLine, line)
 	}
 
 	for _, c := range parts[0] {
 		if c < 'A' || c > 'Z' {
-			return nil, 0, fmt.Errorf("Invalid format")
+			return nil, 0, fmt.Errorf("%w: invalid method %q", ErrMalformedRequestLine, parts[0])
 		}
 	}
 
+	version, ok := strings.CutPrefix(parts[2], "HTTP/")
+	if !ok || len(version) != 3 || !isDigits(version[:1]) || version[1] != '.' || !isDigits(version[2:]) {
+		return nil, 0, fmt.Errorf("%w: invalid version %q", ErrMalformedRequestLine, parts[2])
+	}
+	// any HTTP/1.x is answered as the 1.x we speak; other majors are not ours
+	if version[0] != '1' {
+		return nil, 0, fmt.Errorf("%w: HTTP/%s", ErrUnsupportedVersion, version)
+	}
+
 	newRequestLine := &RequestLine{
 		Method:        parts[0],
 		RequestTarget: parts[1],
-		HttpVersion:   version[1],
+		HttpVersion:   version,
 	}
 
 	bytesConsumed := idx + len("\r\n")
@@ -122,12 +214,13 @@ func (r *Request) parse(data []byte) (int, error) {
 	total := 0
 
 	for r.state != stateDone {
+		prev := r.state
 		n, err := r.parseSingle(data[total:])
 		if err != nil {
 			return 0, err
 		}
 		total += n
-		if n == 0 {
+		if n == 0 && r.state == prev {
 			break
 		}
 	}
@@ -142,49 +235,102 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		if n == 0 && exceeds(len(data), r.limits.MaxRequestLine) || exceeds(n-2, r.limits.MaxRequestLine) {
+			return 0, fmt.Errorf("%w: over %d bytes", ErrRequestLineTooLong, r.limits.MaxRequestLine)
+		}
 		if n == 0 {
 			return 0, nil
 		}
+		target, err := ParseTarget(r1.Method, r1.RequestTarget)
+		if err != nil {
+			return 0, err
+		}
 		r.RequestLine = *r1
+		r.Target = target
 		r.state = stateParsingHeaders
 		return n, nil
 
 	case stateParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.parseField(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
 		if done {
-			r.state = stateParsingBody
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
+			if err := r.checkExpect(); err != nil {
+				return 0, err
+			}
 		}
 		return n, nil
 
 	case stateParsingBody:
-		clStr := r.Headers.Get("content-length")
-		if clStr == "" {
+		// anything past Content-Length belongs to the next request
+		n := min(len(data), r.bodyRemaining)
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyRemaining -= n
+
+		if r.bodyRemaining == 0 {
 			r.state = stateDone
+		}
+
+		return n, nil
+
+	case stateParsingChunkSize:
+		idx := bytes.Index(data, []byte("\r\n"))
+		if idx < 0 && exceeds(len(data), r.limits.MaxHeaderLine) || exceeds(idx, r.limits.MaxHeaderLine) {
+			return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+		}
+		if idx < 0 {
 			return 0, nil
 		}
 
-		contentLength, err := strconv.Atoi(clStr)
-		if err != nil || contentLength < 0 {
-			return 0, fmt.Errorf("invalid Content-Length")
+		size, err := parseChunkSize(data[:idx])
+		if err != nil {
+			return 0, err
 		}
+		if err := r.addBodySize(size); err != nil {
+			return 0, err
+		}
+
+		if size == 0 {
+			r.state = stateParsingTrailers
+		} else {
+			r.chunkRemaining = size
+			r.state = stateParsingChunkData
+		}
+		return idx + 2, nil
 
-		incoming := data
-		newLen := len(r.Body) + len(incoming)
+	case stateParsingChunkData:
+		n := min(len(data), r.chunkRemaining)
+		r.pending = append(r.pending, data[:n]...)
+		r.chunkRemaining -= n
 
-		if newLen > contentLength {
-			return 0, fmt.Errorf("body larger than Content-Length")
+		if r.chunkRemaining == 0 {
+			r.state = stateParsingChunkEnd
 		}
+		return n, nil
 
-		r.Body = append(r.Body, incoming...)
+	case stateParsingChunkEnd:
+		if len(data) < 2 {
+			return 0, nil
+		}
+		if data[0] != '\r' || data[1] != '\n' {
+			return 0, fmt.Errorf("%w: missing CRLF after chunk data", ErrMalformedChunk)
+		}
+		r.state = stateParsingChunkSize
+		return 2, nil
 
-		if newLen == contentLength {
+	case stateParsingTrailers:
+		n, done, err := r.parseField(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
 			r.state = stateDone
 		}
-
-		return len(incoming), nil
+		return n, nil
 
 	case stateDone:
 		return 0, fmt.Errorf("cannot parse in done state")
@@ -193,3 +339,87 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		return 0, fmt.Errorf("unknown state")
 	}
 }
+
+func (r *Request) startBody() error {
+	if len(r.Headers.Values("transfer-encoding")) > 0 {
+		if len(r.Headers.Values("content-length")) > 0 {
+			return ErrAmbiguousFraming
+		}
+		// HTTP/1.0 has no transfer codings, so a proxy may not have honoured it
+		if r.HTTP10() {
+			return fmt.Errorf("%w: Transfer-Encoding in an HTTP/1.0 request", ErrInvalidTransferEncoding)
+		}
+		if err := checkTransferEncoding(r.Headers); err != nil {
+			return err
+		}
+		r.state = stateParsingChunkSize
+		return nil
+	}
+
+	contentLength, err := contentLength(r.Headers)
+	if err != nil {
+		return err
+	}
+	if contentLength <= 0 {
+		r.state = stateDone
+		return nil
+	}
+	if err := r.addBodySize(contentLength); err != nil {
+		return err
+	}
+
+	r.bodyRemaining = contentLength
+	r.state = stateParsingBody
+	return nil
+}
+
+// parseChunkSize parses a chunk-size line, ignoring any chunk extensions.
+func parseChunkSize(line []byte) (int, error) {
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+
+	if len(line) == 0 {
+		return 0, fmt.Errorf("%w: missing chunk size", ErrMalformedChunk)
+	}
+	for _, c := range line {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, line)
+		}
+	}
+
+	size, err := strconv.ParseInt(string(line), 16, strconv.IntSize)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, line)
+	}
+	return int(size), nil
+}
+
+// PathValue returns a parameter captured by the router, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
+	}
+	r.pathValues[name] = value
+}
+
+// KeepAlive reports whether the client is willing to reuse the connection:
+// HTTP/1.1 unless it says close, HTTP/1.0 only if it asks for keep-alive.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("connection", "close") {
+		return false
+	}
+	if r.HTTP10() {
+		return r.Headers.HasToken("connection", "keep-alive")
+	}
+	return true
+}
+
+func (r *Request) HTTP10() bool {
+	return r.RequestLine.HttpVersion == "1.0"
+}
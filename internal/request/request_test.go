@@ -74,9 +74,9 @@ func TestRequest_ParseHeaders(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
+	assert.Equal(t, "*/*", r.Headers.Get("accept"))
 }
 
 // Test: Malformed Header
@@ -98,7 +98,7 @@ func TestRequest_EmptyHeaders(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 	assert.NotNil(t, r.Headers)
-	assert.Equal(t, 0, len(r.Headers))
+	assert.Equal(t, 0, r.Headers.Len())
 }
 
 func TestRequest_DuplicateHeaders(t *testing.T) {
@@ -111,7 +111,7 @@ func TestRequest_DuplicateHeaders(t *testing.T) {
 	require.NotNil(t, r)
 
 	t.Logf("headers: %#v", r.Headers)
-	assert.Equal(t, "one.example, two.example", r.Headers["host"])
+	assert.Equal(t, "one.example, two.example", r.Headers.Get("host"))
 }
 
 func TestRequest_CaseInsensitiveHeaders(t *testing.T) {
@@ -123,8 +123,8 @@ func TestRequest_CaseInsensitiveHeaders(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
+	assert.Equal(t, "localhost:42069", r.Headers.Get("host"))
+	assert.Equal(t, "curl/7.81.0", r.Headers.Get("user-agent"))
 }
 
 func TestRequest_MissingEndOfHeaders(t *testing.T) {
@@ -212,3 +212,243 @@ func TestRequestBody_NoContentLengthButBodyExists(t *testing.T) {
 	// we assume no body if Content-Length is missing
 	assert.Equal(t, "", string(r.Body))
 }
+
+func TestReader_PipelinedRequests(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+
+	r1, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r1.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r1.Body))
+
+	r2, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r2.RequestLine.RequestTarget)
+	assert.Equal(t, "localhost:42069", r2.Headers.Get("host"))
+
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestRequest_KeepAlive(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nConnection: Close\r\n\r\n"))
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+}
+
+func TestRequest_HTTP10(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.True(t, r.HTTP10())
+	assert.False(t, r.KeepAlive())
+
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// a later 1.x minor is served as 1.1
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.2\r\n\r\n"))
+	require.NoError(t, err)
+	assert.False(t, r.HTTP10())
+	assert.True(t, r.KeepAlive())
+
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidTransferEncoding)
+}
+
+func TestRequestBody_Chunked(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"7;name=value\r\nworld!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, 0, r.Trailers.Len())
+}
+
+func TestRequestBody_ChunkedWithTrailers(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"A\r\n0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", string(r.Body))
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+}
+
+func TestRequestBody_ChunkedFollowedByRequest(t *testing.T) {
+	reader := NewReader(strings.NewReader(
+		"POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+	))
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+}
+
+func TestRequestBody_ChunkedInvalidSize(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+
+	_, err := RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestRequestBody_ChunkedMissingCRLF(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabcdef\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+
+	_, err := RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestRequestBody_ChunkedIncomplete(t *testing.T) {
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nabc",
+		numBytesPerRead: 3,
+	}
+
+	r, err := RequestFromReader(reader)
+	require.Error(t, err)
+	assert.Nil(t, r)
+}
+
+func TestStreamRequest_ReturnsBeforeBody(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "POST /upload HTTP/1.1\r\nContent-Length: 11\r\n\r\n")
+		io.WriteString(pw, "hello ")
+		io.WriteString(pw, "world")
+		pw.Close()
+	}()
+
+	r, err := NewReader(pr).StreamRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	assert.Nil(t, r.Body)
+
+	data, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestStreamRequest_ChunkedBodyReader(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"6\r\n world\r\n" +
+			"0\r\n" +
+			"X-Done: yes\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	})
+
+	r, err := reader.StreamRequest()
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r.BodyReader())
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Equal(t, "yes", r.Trailers.Get("x-done"))
+}
+
+func TestStreamRequest_CloseDrainsBody(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Length: 10\r\n" +
+			"\r\n" +
+			"0123456789" +
+			"GET /next HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	})
+
+	r, err := reader.StreamRequest()
+	require.NoError(t, err)
+
+	body := r.BodyReader()
+	buf := make([]byte, 4)
+	n, err := body.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "012", string(buf[:n]))
+	require.NoError(t, body.Close())
+
+	_, err = body.Read(buf)
+	assert.ErrorIs(t, err, ErrBodyClosed)
+
+	r, err = reader.StreamRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+}
+
+func TestStreamRequest_ReadBodyIncomplete(t *testing.T) {
+	r, err := NewReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort")).StreamRequest()
+	require.NoError(t, err)
+
+	_, err = r.ReadBody()
+	assert.ErrorIs(t, err, ErrIncompleteRequest)
+}
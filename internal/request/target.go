@@ -0,0 +1,144 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 §3.2.
+type TargetForm int
+
+const (
+	OriginForm    TargetForm = iota // /where?q=now
+	AbsoluteForm                    // http://www.example.org/pub/WWW/
+	AuthorityForm                   // www.example.com:80 (CONNECT only)
+	AsteriskForm                    // * (OPTIONS only)
+)
+
+var ErrInvalidTarget = errors.New("invalid request target")
+
+type Target struct {
+	Form TargetForm
+
+	// Scheme and Host are only set for absolute-form and authority-form
+	// targets; Host includes the port if one was given.
+	Scheme string
+	Host   string
+
+	Path     string // percent-decoded
+	RawPath  string // as sent, still escaped
+	RawQuery string
+	Query    url.Values
+}
+
+func ParseTarget(method, raw string) (Target, error) {
+	if raw == "" {
+		return Target{}, fmt.Errorf("%w: empty", ErrInvalidTarget)
+	}
+	for i := 0; i < len(raw); i++ {
+		if c := raw[i]; c <= ' ' || c == 0x7f {
+			return Target{}, fmt.Errorf("%w: invalid character %q", ErrInvalidTarget, c)
+		}
+	}
+	if strings.Contains(raw, "#") {
+		return Target{}, fmt.Errorf("%w: fragment not allowed", ErrInvalidTarget)
+	}
+
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(raw)
+
+	case raw == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: * is only allowed for OPTIONS", ErrInvalidTarget)
+		}
+		return Target{Form: AsteriskForm, Query: url.Values{}}, nil
+
+	case strings.HasPrefix(raw, "/"):
+		t := Target{Form: OriginForm}
+		err := t.setPathAndQuery(raw)
+		return t, err
+
+	default:
+		return parseAbsoluteForm(raw)
+	}
+}
+
+func parseAuthorityForm(raw string) (Target, error) {
+	i := strings.LastIndex(raw, ":")
+	if i <= 0 || i == len(raw)-1 || strings.ContainsAny(raw, "/?@") {
+		return Target{}, fmt.Errorf("%w: CONNECT requires host:port, got %q", ErrInvalidTarget, raw)
+	}
+	port := raw[i+1:]
+	for _, c := range port {
+		if c < '0' || c > '9' {
+			return Target{}, fmt.Errorf("%w: invalid port %q", ErrInvalidTarget, port)
+		}
+	}
+	return Target{Form: AuthorityForm, Host: raw, Query: url.Values{}}, nil
+}
+
+func parseAbsoluteForm(raw string) (Target, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: %q", ErrInvalidTarget, raw)
+	}
+
+	host := rest
+	pathAndQuery := "/"
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		host = rest[:i]
+		pathAndQuery = rest[i:]
+		if pathAndQuery[0] == '?' {
+			pathAndQuery = "/" + pathAndQuery
+		}
+	}
+	if host == "" || strings.Contains(host, "@") {
+		return Target{}, fmt.Errorf("%w: invalid authority in %q", ErrInvalidTarget, raw)
+	}
+
+	t := Target{
+		Form:   AbsoluteForm,
+		Scheme: strings.ToLower(scheme),
+		Host:   host,
+	}
+	err := t.setPathAndQuery(pathAndQuery)
+	return t, err
+}
+
+func (t *Target) setPathAndQuery(raw string) error {
+	rawPath, rawQuery, _ := strings.Cut(raw, "?")
+
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+
+	t.Path = path
+	t.RawPath = rawPath
+	t.RawQuery = rawQuery
+	t.Query = query
+	return nil
+}
+
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
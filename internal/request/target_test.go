@@ -0,0 +1,96 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget_OriginForm(t *testing.T) {
+	target, err := ParseTarget("GET", "/files/my%20doc.txt?tag=a&tag=b&q=go+lang")
+	require.NoError(t, err)
+	assert.Equal(t, OriginForm, target.Form)
+	assert.Equal(t, "/files/my doc.txt", target.Path)
+	assert.Equal(t, "/files/my%20doc.txt", target.RawPath)
+	assert.Equal(t, "tag=a&tag=b&q=go+lang", target.RawQuery)
+	assert.Equal(t, []string{"a", "b"}, target.Query["tag"])
+	assert.Equal(t, "go lang", target.Query.Get("q"))
+}
+
+func TestParseTarget_AbsoluteForm(t *testing.T) {
+	target, err := ParseTarget("GET", "HTTP://example.com:8080?x=1")
+	require.NoError(t, err)
+	assert.Equal(t, AbsoluteForm, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "example.com:8080", target.Host)
+	assert.Equal(t, "/", target.Path)
+	assert.Equal(t, "1", target.Query.Get("x"))
+
+	target, err = ParseTarget("GET", "http://www.example.org/pub/WWW/")
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.org", target.Host)
+	assert.Equal(t, "/pub/WWW/", target.Path)
+}
+
+func TestParseTarget_AuthorityForm(t *testing.T) {
+	target, err := ParseTarget("CONNECT", "www.example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, AuthorityForm, target.Form)
+	assert.Equal(t, "www.example.com:443", target.Host)
+
+	target, err = ParseTarget("CONNECT", "[::1]:8443")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:8443", target.Host)
+
+	_, err = ParseTarget("CONNECT", "/not/authority")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+
+	_, err = ParseTarget("CONNECT", "example.com")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestParseTarget_AsteriskForm(t *testing.T) {
+	target, err := ParseTarget("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, AsteriskForm, target.Form)
+
+	_, err = ParseTarget("GET", "*")
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestParseTarget_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"/page#section",
+		"/bad%zzescape",
+		"/?q=%zz",
+		"no-scheme",
+		"http://",
+		"http://user@example.com/",
+		"/tab\there",
+	} {
+		_, err := ParseTarget("GET", raw)
+		assert.ErrorIs(t, err, ErrInvalidTarget, raw)
+	}
+}
+
+func TestRequest_ParsedTarget(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET /search?q=tcp HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/search?q=tcp", r.RequestLine.RequestTarget)
+	assert.Equal(t, "/search", r.Target.Path)
+	assert.Equal(t, "tcp", r.Target.Query.Get("q"))
+}
+
+func TestRequest_FragmentRejected(t *testing.T) {
+	reader := &chunkReader{
+		data:            "GET /page#top HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidTarget)
+}
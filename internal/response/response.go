@@ -6,17 +6,8 @@ import (
 	"github.com/Skorgum/httpfromtcp/internal/headers"
 )
 
-type StatusCode int
-
-const (
-	StatusOk                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-)
-
-func GetDefaultHeaders(contentLen int) headers.Headers {
+func GetDefaultHeaders(contentLen int) *headers.Headers {
 	h := headers.NewHeaders()
-	h.Set("Content-Length", strconv.Itoa(contentLen))
-	h.Set("Connection", "close")
+	h.Override("Content-Length", strconv.Itoa(contentLen))
 	return h
 }
@@ -3,6 +3,7 @@ package response
 import (
 	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/Skorgum/httpfromtcp/internal/headers"
 )
@@ -17,82 +18,417 @@ const (
 	stateTrailersWritten
 )
 
+// bufferThreshold is how much of a body Write holds back before giving up on
+// Content-Length and switching to chunked encoding.
+const bufferThreshold = 4096
+
 type Writer struct {
-	state writerState
-	w     io.Writer
+	state         writerState
+	w             io.Writer
+	keepAlive     bool
+	chunked       bool
+	contentLength int
+	bodyWritten   int
+	statusCode    StatusCode
+	headerHooks   []func(h *headers.Headers)
+	http10        bool
+	omitBody      bool
+	// set when a handler's chunked body is being sent raw to an HTTP/1.0
+	// client, delimited by closing the connection
+	unchunked bool
+
+	// set by the io.Writer-style API (Header, SetStatus, Write)
+	auto          bool
+	header        *headers.Headers
+	pendingStatus StatusCode
+	buf           []byte
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		state: stateInit,
-		w:     w,
+		state:         stateInit,
+		w:             w,
+		contentLength: -1,
 	}
 }
 
-func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+// SetKeepAlive lets the server offer to reuse the connection. The response
+// still closes it if its headers ask to or its body length can't be delimited.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetVersion picks the protocol version of the response, "1.1" (the default)
+// or "1.0". HTTP/1.0 has no chunked encoding, so a body whose length isn't
+// known up front is delimited by closing the connection instead.
+func (w *Writer) SetVersion(version string) error {
+	switch version {
+	case "1.0":
+		w.http10 = true
+	case "1.1":
+		w.http10 = false
+	default:
+		return fmt.Errorf("unsupported version %q", version)
+	}
+	return nil
+}
+
+// SetOmitBody makes the writer answer a HEAD request: the status line and
+// headers go out exactly as they would for GET, including Content-Length or
+// chunked Transfer-Encoding, but body bytes and trailers are dropped.
+func (w *Writer) SetOmitBody(omit bool) {
+	w.omitBody = omit
+}
+
+// KeepAlive reports whether a complete response was written and the
+// connection can carry another request.
+func (w *Writer) KeepAlive() bool {
+	if !w.keepAlive {
+		return false
+	}
+	if w.omitBody {
+		return w.state >= stateHeadersWritten
+	}
+	if w.chunked {
+		return w.state == stateTrailersWritten
+	}
+	return w.state >= stateHeadersWritten && w.bodyWritten == w.contentLength
+}
+
+// StatusCode returns the response status, or 0 if none has been chosen yet.
+// A status set with SetStatus counts even before it is sent.
+func (w *Writer) StatusCode() StatusCode {
+	if w.statusCode == 0 && w.auto {
+		return w.pendingStatus
+	}
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written, including any Write
+// is still buffering but not counting chunked framing. It is 0 when the body
+// is omitted.
+func (w *Writer) BytesWritten() int {
+	if w.omitBody {
+		return 0
+	}
+	return w.bodyWritten + len(w.buf)
+}
+
+// Header returns the headers sent with the response. They can be changed
+// until the headers are written; WriteHeaders adds any the handler's own
+// header block lacks.
+func (w *Writer) Header() *headers.Headers {
+	if w.header == nil {
+		w.header = headers.NewHeaders()
+	}
+	return w.header
+}
+
+// SetStatus chooses the status for a response written with Write. Nothing is
+// sent until the first Write that overflows the buffer, or Finish.
+func (w *Writer) SetStatus(statusCode StatusCode) {
+	if w.state == stateInit {
+		w.auto = true
+		w.pendingStatus = statusCode
+	}
+}
+
+// Write sends body bytes, writing a 200 status line and the Header() fields
+// first if nothing was sent yet. Small bodies are buffered and sent with a
+// Content-Length by Finish; larger ones are sent chunked unless the handler
+// set Content-Length itself.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.state == stateInit {
+		w.auto = true
+		if w.pendingStatus == 0 {
+			w.pendingStatus = StatusOk
+		}
+		if len(w.buf)+len(p) <= bufferThreshold {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		if err := w.commit(false); err != nil {
+			return 0, err
+		}
+	}
+	if !w.auto {
+		return 0, fmt.Errorf("cannot mix Write with WriteHeaders")
+	}
+
+	if w.chunked {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if _, err := w.WriteChunkedBody(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.WriteBody(p)
+}
+
+// Flush sends the status line, headers and any buffered body right away,
+// committing to chunked encoding unless Content-Length was set.
+func (w *Writer) Flush() error {
 	if w.state != stateInit {
-		return fmt.Errorf("cannot write status line in state %d", w.state)
+		return nil
+	}
+	w.auto = true
+	return w.commit(false)
+}
+
+// Finish completes a response written with Write, and sends an empty 200 if
+// the handler wrote nothing at all. It is called by the server once the
+// handler returns.
+func (w *Writer) Finish() error {
+	if w.state == stateInit {
+		w.auto = true
+		return w.commit(true)
+	}
+	if !w.auto || !w.chunked {
+		return nil
+	}
+	if _, err := w.WriteChunkedBodyDone(); err != nil {
+		return err
+	}
+	return w.WriteTrailers(headers.NewHeaders())
+}
+
+// Reset throws away a response that hasn't been sent yet, so an error
+// response can be written in its place. It reports false if any of the
+// response already went out.
+func (w *Writer) Reset() bool {
+	if w.state != stateInit {
+		return false
+	}
+	w.auto = false
+	w.header = nil
+	w.pendingStatus = 0
+	w.buf = nil
+	return true
+}
+
+// commit writes the status line and headers for the io.Writer-style API,
+// followed by whatever body is buffered. complete means the buffer holds the
+// entire body, so its length can be announced.
+func (w *Writer) commit(complete bool) error {
+	code := w.pendingStatus
+	if code == 0 {
+		code = StatusOk
+	}
+	// checked up front so a bad header leaves nothing on the wire and the
+	// response can still be replaced
+	if err := w.Header().Validate(); err != nil {
+		return err
+	}
+	if err := w.WriteStatusLine(code); err != nil {
+		return err
 	}
 
-	var reason string
-	switch statusCode {
-	case StatusOk:
-		reason = "OK"
-	case StatusBadRequest:
-		reason = "Bad Request"
-	case StatusInternalServerError:
-		reason = "Internal Server Error"
+	h := w.Header()
+	switch {
+	case bodyless(code), h.Get("content-length") != "":
+	case complete:
+		h.Override("Content-Length", strconv.Itoa(len(w.buf)))
+	case w.http10:
+		// left undelimited; WriteHeaders closes the connection
 	default:
-		reason = ""
+		h.Override("Transfer-Encoding", "chunked")
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
 	}
 
-	var err error
-	if reason == "" {
-		_, err = fmt.Fprintf(w.w, "HTTP/1.1 %d \r\n", int(statusCode))
-	} else {
-		_, err = fmt.Fprintf(w.w, "HTTP/1.1 %d %s\r\n", int(statusCode), reason)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
 	}
-	if err != nil {
+	if w.chunked {
+		_, err := w.WriteChunkedBody(buf)
+		return err
+	}
+	_, err := w.WriteBody(buf)
+	return err
+}
+
+// OnWriteHeaders registers fn to be called with the header block just before
+// it is written, so wrappers can add or change fields.
+func (w *Writer) OnWriteHeaders(fn func(h *headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, fn)
+}
+
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes a status line with a custom reason phrase,
+// which may be empty.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
+	if w.state != stateInit {
+		return fmt.Errorf("cannot write status line in state %d", w.state)
+	}
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("invalid status code %d", statusCode)
+	}
+	if !validReason(reason) {
+		return fmt.Errorf("invalid reason phrase %q", reason)
+	}
+
+	version := "1.1"
+	if w.http10 {
+		version = "1.0"
+	}
+	if _, err := fmt.Fprintf(w.w, "HTTP/%s %d %s\r\n", version, int(statusCode), reason); err != nil {
 		return err
 	}
 
 	w.state = stateStatusWritten
+	w.statusCode = statusCode
 	return nil
 }
 
-func (w *Writer) WriteHeaders(h headers.Headers) error {
+// bodyless reports whether responses with code never carry a body, whatever
+// their headers say (RFC 9110 §6.4.1).
+func bodyless(code StatusCode) bool {
+	return code < 200 || code == StatusNoContent || code == StatusNotModified
+}
+
+// validReason reports whether s fits the reason-phrase grammar: tabs, spaces
+// and visible characters only.
+func validReason(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *Writer) WriteHeaders(h *headers.Headers) error {
 	if w.state != stateStatusWritten {
 		return fmt.Errorf("cannot write headers in state %d", w.state)
 	}
 
-	for k, v := range h {
+	if w.header != nil && !w.auto {
+		added := make(map[string]bool)
+		for k, v := range w.header.All() {
+			if added[k] || len(h.Values(k)) == 0 {
+				h.Add(k, v)
+				added[k] = true
+			}
+		}
+	}
+	for _, fn := range w.headerHooks {
+		fn(h)
+	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
+	w.chunked = h.HasToken("transfer-encoding", "chunked")
+	if w.chunked && w.http10 {
+		h.Del("Transfer-Encoding")
+		h.Del("Trailer")
+		w.chunked = false
+		w.unchunked = true
+	}
+	if cl, err := strconv.Atoi(h.Get("content-length")); err == nil && !w.chunked {
+		w.contentLength = cl
+	}
+	if bodyless(w.statusCode) {
+		w.chunked = false
+		w.contentLength = 0
+	}
+	if h.HasToken("connection", "close") || (!w.chunked && w.contentLength < 0 && !w.omitBody) {
+		w.keepAlive = false
+	}
+	if !w.keepAlive {
+		h.Override("Connection", "close")
+	} else if w.http10 {
+		h.Override("Connection", "keep-alive")
+	}
+
+	if err := w.writeFields(h); err != nil {
+		return err
+	}
+
+	w.state = stateHeadersWritten
+	return nil
+}
+
+// writeFields writes a header or trailer block and the empty line ending it.
+func (w *Writer) writeFields(h *headers.Headers) error {
+	for k, v := range h.All() {
 		line := []byte(fmt.Sprintf("%s: %s\r\n", k, v))
 		if _, err := w.w.Write(line); err != nil {
 			return err
 		}
 	}
 
-	if _, err := w.w.Write([]byte("\r\n")); err != nil {
+	_, err := w.w.Write([]byte("\r\n"))
+	return err
+}
+
+// WriteInformational sends a 1xx interim response, such as 103 Early Hints,
+// ahead of the final one. h may be nil. HTTP/1.0 clients don't understand
+// interim responses, so nothing is sent to them.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.state != stateInit {
+		return fmt.Errorf("cannot write interim response in state %d", w.state)
+	}
+	// 101 hands the connection to another protocol, which this writer can't
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("invalid interim status code %d", statusCode)
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	if err := h.Validate(); err != nil {
 		return err
 	}
+	if w.http10 {
+		return nil
+	}
 
-	w.state = stateHeadersWritten
-	return nil
+	if _, err := fmt.Fprintf(w.w, "HTTP/1.1 %d %s\r\n", int(statusCode), StatusText(statusCode)); err != nil {
+		return err
+	}
+	return w.writeFields(h)
 }
 
+// WriteBody may be called more than once to stream a body whose length was
+// announced with Content-Length.
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.state != stateHeadersWritten {
+	if w.state != stateHeadersWritten && w.state != stateBodyWritten {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return 0, fmt.Errorf("body exceeds Content-Length of %d", w.contentLength)
+	}
 
 	w.state = stateBodyWritten
-	return w.w.Write(p)
+	if w.omitBody {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+	n, err := w.w.Write(p)
+	w.bodyWritten += n
+	return n, err
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.state != stateHeadersWritten && w.state != stateBodyWritten {
 		return 0, fmt.Errorf("cannot write chunked body in state %d", w.state)
 	}
+	if w.unchunked {
+		return w.WriteBody(p)
+	}
+	if w.omitBody {
+		w.bodyWritten += len(p)
+		w.state = stateBodyWritten
+		return len(p), nil
+	}
 
 	chunkSize := len(p)
 	total := 0
@@ -104,6 +440,7 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	total += n
 
 	n, err = w.w.Write(p)
+	w.bodyWritten += n
 	if err != nil {
 		return total, err
 	}
@@ -123,6 +460,11 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.state != stateBodyWritten && w.state != stateHeadersWritten {
 		return 0, fmt.Errorf("cannot finish chunked body in state %d", w.state)
 	}
+	// the body is over even if it was empty, so trailers can follow
+	w.state = stateBodyWritten
+	if w.unchunked || w.omitBody {
+		return 0, nil
+	}
 
 	n, err := w.w.Write([]byte("0\r\n"))
 	if err != nil {
@@ -131,19 +473,21 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	return n, nil
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
 	if w.state != stateBodyWritten {
 		return fmt.Errorf("cannot write trailers in state %d", w.state)
 	}
-
-	for k, v := range h {
-		line := []byte(fmt.Sprintf("%s: %s\r\n", k, v))
-		if _, err := w.w.Write(line); err != nil {
-			return err
-		}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	// trailers are part of the body: without chunked encoding there is
+	// nowhere to put them, and a HEAD response has none
+	if w.unchunked || w.omitBody {
+		w.state = stateTrailersWritten
+		return nil
 	}
 
-	if _, err := w.w.Write([]byte("\r\n")); err != nil {
+	if err := w.writeFields(h); err != nil {
 		return err
 	}
 
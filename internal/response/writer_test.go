@@ -0,0 +1,442 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStatusLine_ReasonPhrases(t *testing.T) {
+	for code, want := range map[StatusCode]string{
+		StatusOk:                 "HTTP/1.1 200 OK\r\n",
+		StatusCreated:            "HTTP/1.1 201 Created\r\n",
+		StatusNoContent:          "HTTP/1.1 204 No Content\r\n",
+		StatusMovedPermanently:   "HTTP/1.1 301 Moved Permanently\r\n",
+		StatusNotModified:        "HTTP/1.1 304 Not Modified\r\n",
+		StatusNotFound:           "HTTP/1.1 404 Not Found\r\n",
+		StatusContentTooLarge:    "HTTP/1.1 413 Content Too Large\r\n",
+		StatusTooManyRequests:    "HTTP/1.1 429 Too Many Requests\r\n",
+		StatusServiceUnavailable: "HTTP/1.1 503 Service Unavailable\r\n",
+		StatusCode(599):          "HTTP/1.1 599 \r\n",
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, NewWriter(&buf).WriteStatusLine(code))
+		assert.Equal(t, want, buf.String())
+	}
+}
+
+func TestWriteStatusLineReason(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusOk, "Totally Fine"))
+	assert.Equal(t, "HTTP/1.1 200 Totally Fine\r\n", buf.String())
+	assert.Equal(t, StatusOk, w.StatusCode())
+
+	assert.Error(t, NewWriter(&buf).WriteStatusLineReason(StatusOk, "OK\r\nX-Injected: 1"))
+	assert.Error(t, NewWriter(&buf).WriteStatusLine(StatusCode(42)))
+}
+
+func TestWriter_KeepAlive(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusOk)
+	w.WriteHeaders(GetDefaultHeaders(2))
+	assert.False(t, w.KeepAlive())
+	w.WriteBody([]byte("hi"))
+	assert.True(t, w.KeepAlive())
+	assert.NotContains(t, buf.String(), "Connection: close")
+
+	// no way to delimit the body other than closing
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusOk)
+	h := GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	w.WriteHeaders(h)
+	assert.False(t, w.KeepAlive())
+	assert.Contains(t, buf.String(), "Connection: close")
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusNoContent)
+	w.WriteHeaders(headers.NewHeaders())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriter_WriteBuffersSmallBodies(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Override("Content-Type", "text/plain")
+
+	w.Write([]byte("hello "))
+	w.Write([]byte("world"))
+	assert.Equal(t, 0, buf.Len())
+	assert.Equal(t, StatusOk, w.StatusCode())
+	assert.Equal(t, 11, w.BytesWritten())
+
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 11\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+}
+
+func TestWriter_WriteSwitchesToChunked(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.SetStatus(StatusCreated)
+
+	big := bytes.Repeat([]byte("a"), bufferThreshold+1)
+	n, err := w.Write(big)
+	require.NoError(t, err)
+	assert.Equal(t, len(big), n)
+	w.Write([]byte("tail"))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	out := buf.String()
+	assert.Contains(t, out, "HTTP/1.1 201 Created\r\n")
+	assert.Contains(t, out, "Transfer-Encoding: chunked\r\n")
+	assert.NotContains(t, out, "Content-Length")
+	assert.True(t, strings.HasSuffix(out, "\r\n4\r\ntail\r\n0\r\n\r\n"), out[len(out)-20:])
+}
+
+func TestWriter_WriteWithDeclaredContentLength(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Override("Content-Length", strconv.Itoa(bufferThreshold*2))
+
+	chunk := bytes.Repeat([]byte("b"), bufferThreshold)
+	w.Write(chunk)
+	w.Write(chunk)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.NotContains(t, buf.String(), "chunked")
+
+	_, err := w.Write([]byte("one too many"))
+	assert.Error(t, err)
+}
+
+func TestWriter_FinishWithoutWrites(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", buf.String())
+}
+
+func TestWriter_Reset(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetStatus(StatusCreated)
+	w.Write([]byte("partial"))
+	assert.True(t, w.Reset())
+
+	w.WriteStatusLine(StatusInternalServerError)
+	assert.False(t, w.Reset())
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", buf.String())
+}
+
+func TestWriteHeaders_OrderAndCasing(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusOk)
+
+	h := headers.NewHeaders()
+	h.Override("content-type", "text/plain")
+	h.Override("X-Content-SHA256", "abc")
+	h.Override("x-request-id", "42")
+	h.Override("Content-Length", "0")
+	h.Override("CONTENT-TYPE", "text/html")
+	require.NoError(t, w.WriteHeaders(h))
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/html\r\n"+
+		"X-Content-SHA256: abc\r\n"+
+		"X-Request-Id: 42\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteTrailers_Order(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteStatusLine(StatusOk)
+	h := headers.NewHeaders()
+	h.Override("Transfer-Encoding", "chunked")
+	w.WriteHeaders(h)
+	w.WriteChunkedBody([]byte("hi"))
+	w.WriteChunkedBodyDone()
+
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Content-SHA256", "abc")
+	trailers.Override("X-Content-Length", "2")
+	require.NoError(t, w.WriteTrailers(trailers))
+
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\nX-Content-SHA256: abc\r\nX-Content-Length: 2\r\n\r\n"))
+}
+
+func TestWriteHeaders_OneLinePerValue(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Add("Set-Cookie", "session=abc; HttpOnly")
+	w.Header().Add("Set-Cookie", "theme=dark; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	w.Write([]byte("ok"))
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Set-Cookie: session=abc; HttpOnly\r\n"+
+		"Set-Cookie: theme=dark; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n"+
+		"Content-Length: 2\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"ok", buf.String())
+}
+
+func TestWriteHeaders_MergesWriterHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Origin")
+	w.Header().Add("Content-Type", "text/plain")
+
+	w.WriteStatusLine(StatusOk)
+	h := GetDefaultHeaders(0)
+	h.Override("Content-Type", "text/html")
+	require.NoError(t, w.WriteHeaders(h))
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/html\r\n"+
+		"Vary: Accept\r\n"+
+		"Vary: Origin\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteHeaders_RejectsInjection(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteStatusLine(StatusFound)
+	h := GetDefaultHeaders(0)
+	h.Override("Location", "/next\r\nSet-Cookie: evil=1")
+
+	var valueErr *headers.InvalidFieldValueError
+	require.ErrorAs(t, w.WriteHeaders(h), &valueErr)
+	assert.Equal(t, "Location", valueErr.Name)
+	assert.NotContains(t, buf.String(), "evil")
+}
+
+func TestWriter_InvalidHeaderWritesNothing(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Override("X-Echo", "a\x00b")
+	w.Write([]byte("ok"))
+
+	var valueErr *headers.InvalidFieldValueError
+	require.ErrorAs(t, w.Finish(), &valueErr)
+	assert.Empty(t, buf.String())
+	assert.True(t, w.Reset())
+}
+
+func TestWriteTrailers_RejectsInvalidName(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteStatusLine(StatusOk)
+	h := headers.NewHeaders()
+	h.Override("Transfer-Encoding", "chunked")
+	w.WriteHeaders(h)
+	w.WriteChunkedBody([]byte("hi"))
+	w.WriteChunkedBodyDone()
+
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Sum\r\nX-Evil", "1")
+	var nameErr *headers.InvalidFieldNameError
+	require.ErrorAs(t, w.WriteTrailers(trailers), &nameErr)
+	assert.NotContains(t, buf.String(), "X-Evil")
+}
+
+func TestWriter_HTTP10StatusLine(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.SetVersion("1.0"))
+	w.SetKeepAlive(true)
+	io.WriteString(w, "ok")
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Content-Length: 2\r\n"+
+		"Connection: keep-alive\r\n"+
+		"\r\n"+
+		"ok", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	assert.Error(t, NewWriter(&buf).SetVersion("2"))
+}
+
+func TestWriter_HTTP10LargeBodyIsCloseDelimited(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetVersion("1.0")
+	w.SetKeepAlive(true)
+	body := strings.Repeat("x", bufferThreshold+1)
+	io.WriteString(w, body)
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\n"+body, buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestWriter_HTTP10DropsChunkedFraming(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetVersion("1.0")
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusOk)
+	h := headers.NewHeaders()
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	w.WriteChunkedBody([]byte("hello "))
+	w.WriteChunkedBody([]byte("world"))
+	w.WriteChunkedBodyDone()
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Sum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, 11, w.BytesWritten())
+}
+
+func TestWriter_OmitBodyKeepsLength(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetOmitBody(true)
+	w.SetKeepAlive(true)
+	w.Header().Override("Content-Type", "video/mp4")
+	io.WriteString(w, "not sent")
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: video/mp4\r\n"+
+		"Content-Length: 8\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, 0, w.BytesWritten())
+}
+
+func TestWriter_OmitBodyChunked(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetOmitBody(true)
+	w.SetKeepAlive(true)
+	w.WriteStatusLine(StatusOk)
+	h := headers.NewHeaders()
+	h.Override("Transfer-Encoding", "chunked")
+	h.Override("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	w.WriteChunkedBody([]byte("hello"))
+	w.WriteChunkedBodyDone()
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Sum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: X-Sum\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriter_OmitBodyLargeAutoBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetOmitBody(true)
+	w.SetKeepAlive(true)
+	io.WriteString(w, strings.Repeat("x", bufferThreshold+1))
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteInformational(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	hints := headers.NewHeaders()
+	hints.Add("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	io.WriteString(w, "ok")
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"\r\n"+
+		"HTTP/1.1 100 Continue\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 2\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		"ok", buf.String())
+
+	assert.Error(t, w.WriteInformational(StatusContinue, nil))
+	assert.Error(t, NewWriter(&buf).WriteInformational(StatusSwitchingProtocols, nil))
+	assert.Error(t, NewWriter(&buf).WriteInformational(StatusOk, nil))
+}
+
+func TestWriteInformational_HTTP10(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	assert.Empty(t, buf.String())
+}
+
+func TestWriter_FlushWithoutBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Finish())
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"0\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriteTrailers_EmptyChunkedBody(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteStatusLine(StatusOk)
+	h := headers.NewHeaders()
+	h.Override("Transfer-Encoding", "chunked")
+	w.WriteHeaders(h)
+	w.WriteChunkedBodyDone()
+
+	trailers := headers.NewHeaders()
+	trailers.Override("X-Sum", "none")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n0\r\nX-Sum: none\r\n\r\n"))
+}
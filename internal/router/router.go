@@ -0,0 +1,271 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Skorgum/httpfromtcp/internal/headers"
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/Skorgum/httpfromtcp/internal/server"
+)
+
+type segmentKind int
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string // literal text or parameter name
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+type Router struct {
+	routes []*route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. A pattern is a path whose
+// segments may be {name} to capture one segment, or a final {name...} to
+// capture the rest of the path. It panics on a malformed pattern.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, r := range rt.routes {
+		if r.method == method && slices.Equal(r.segments, segments) {
+			panic(fmt.Sprintf("router: %s %s registered twice", method, pattern))
+		}
+	}
+
+	rt.routes = append(rt.routes, &route{
+		method:   method,
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+// Handler dispatches to the most specific matching route. GET routes also
+// answer HEAD, OPTIONS is answered with the path's Allow list unless a route
+// handles it, and unmatched requests get 404 or 405.
+func (rt *Router) Handler() server.Handler {
+	return rt.serve
+}
+
+func (rt *Router) serve(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if req.Target.Form == request.AsteriskForm {
+		// OPTIONS * asks about the server as a whole
+		var all []string
+		for _, r := range rt.routes {
+			all = append(all, r.method)
+		}
+		writeAllow(w, response.StatusNoContent, all)
+		return
+	}
+
+	parts, ok := splitPath(req.Target.RawPath)
+	if !ok {
+		writeError(w, response.StatusNotFound, nil)
+		return
+	}
+
+	var best *route
+	var bestValues map[string]string
+	var allowed []string
+
+	for _, r := range rt.routes {
+		values, ok := r.match(parts)
+		if !ok {
+			continue
+		}
+		allowed = append(allowed, r.method)
+		// GET routes answer HEAD too, unless a HEAD route is as specific
+		if r.method != method && (method != "HEAD" || r.method != "GET") {
+			continue
+		}
+		if best == nil || moreSpecific(r.segments, best.segments) ||
+			(r.method == method && best.method != method && !moreSpecific(best.segments, r.segments)) {
+			best = r
+			bestValues = values
+		}
+	}
+
+	switch {
+	case best != nil:
+		for name, value := range bestValues {
+			req.SetPathValue(name, value)
+		}
+		best.handler(w, req)
+	case len(allowed) == 0:
+		writeError(w, response.StatusNotFound, nil)
+	case method == "OPTIONS":
+		writeAllow(w, response.StatusNoContent, allowed)
+	default:
+		writeError(w, response.StatusMethodNotAllowed, map[string]string{
+			"Allow": allowHeader(allowed),
+		})
+	}
+}
+
+// allowHeader lists methods for an Allow header, adding the ones the router
+// answers on its own: HEAD wherever GET is registered, and OPTIONS.
+func allowHeader(methods []string) string {
+	methods = append(slices.Clone(methods), "OPTIONS")
+	if slices.Contains(methods, "GET") {
+		methods = append(methods, "HEAD")
+	}
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
+
+func writeAllow(w *response.Writer, code response.StatusCode, methods []string) {
+	w.WriteStatusLine(code)
+	h := headers.NewHeaders()
+	h.Override("Allow", allowHeader(methods))
+	w.WriteHeaders(h)
+}
+
+func writeError(w *response.Writer, code response.StatusCode, extra map[string]string) {
+	var body []byte
+	switch code {
+	case response.StatusNotFound:
+		body = []byte("404 page not found\n")
+	case response.StatusMethodNotAllowed:
+		body = []byte("405 method not allowed\n")
+	}
+
+	w.WriteStatusLine(code)
+
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/plain")
+	for k, v := range extra {
+		h.Override(k, v)
+	}
+
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("router: pattern %q must start with /", pattern)
+	}
+
+	parts := strings.Split(pattern[1:], "/")
+	segments := make([]segment, 0, len(parts))
+	seen := make(map[string]bool)
+
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("router: bad segment %q in pattern %q", part, pattern)
+			}
+			segments = append(segments, segment{kind: segmentLiteral, value: part})
+			continue
+		}
+
+		name := part[1 : len(part)-1]
+		kind := segmentParam
+		if n, ok := strings.CutSuffix(name, "..."); ok {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("router: %s must be the last segment of %q", part, pattern)
+			}
+			name = n
+			kind = segmentWildcard
+		}
+
+		if name == "" || strings.ContainsAny(name, "{}.") {
+			return nil, fmt.Errorf("router: bad parameter name %q in pattern %q", part, pattern)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("router: duplicate parameter %q in pattern %q", name, pattern)
+		}
+		seen[name] = true
+
+		segments = append(segments, segment{kind: kind, value: name})
+	}
+
+	return segments, nil
+}
+
+// splitPath splits an escaped path into its decoded segments, so an encoded
+// slash stays inside its segment. It fails on a path with a "." or ".."
+// segment, including one that only appears once a segment is decoded.
+func splitPath(rawPath string) ([]string, bool) {
+	if !strings.HasPrefix(rawPath, "/") {
+		return nil, false
+	}
+
+	parts := strings.Split(rawPath[1:], "/")
+	for i, part := range parts {
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, false
+		}
+		for _, piece := range strings.Split(decoded, "/") {
+			if piece == "." || piece == ".." {
+				return nil, false
+			}
+		}
+		parts[i] = decoded
+	}
+	return parts, true
+}
+
+func (r *route) match(parts []string) (map[string]string, bool) {
+	values := make(map[string]string)
+
+	for i, seg := range r.segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentLiteral:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			values[seg.value] = parts[i]
+		case segmentWildcard:
+			values[seg.value] = strings.Join(parts[i:], "/")
+			return values, true
+		}
+	}
+
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+// moreSpecific reports whether a should win over b when both match: at the
+// first segment where they differ in kind, literals beat parameters and
+// parameters beat wildcards.
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].kind != b[i].kind {
+			return a[i].kind < b[i].kind
+		}
+	}
+	return len(a) > len(b)
+}
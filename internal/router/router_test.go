@@ -0,0 +1,201 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, rt *Router, method, target string) (*http.Response, string) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: x\r\n\r\n"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	rt.Handler()(response.NewWriter(&buf), req)
+
+	res, err := http.ReadResponse(bufio.NewReader(&buf), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body)
+}
+
+func reply(text func(req *request.Request) string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := []byte(text(req))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestRouter_PathParameters(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/users/{id}", reply(func(req *request.Request) string {
+		return "user " + req.PathValue("id")
+	}))
+	rt.Handle("GET", "/users/{id}/posts/{post}", reply(func(req *request.Request) string {
+		return req.PathValue("id") + "/" + req.PathValue("post")
+	}))
+
+	res, body := serve(t, rt, "GET", "/users/42")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "user 42", body)
+
+	_, body = serve(t, rt, "GET", "/users/42/posts/7")
+	assert.Equal(t, "42/7", body)
+
+	res, _ = serve(t, rt, "GET", "/users/")
+	assert.Equal(t, 404, res.StatusCode)
+
+	// an encoded slash stays inside the segment
+	res, body = serve(t, rt, "GET", "/users/a%2Fb")
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "user a/b", body)
+}
+
+func TestRouter_Wildcard(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/static/{path...}", reply(func(req *request.Request) string {
+		return "file " + req.PathValue("path")
+	}))
+
+	_, body := serve(t, rt, "GET", "/static/css/site%20v2.css")
+	assert.Equal(t, "file css/site v2.css", body)
+
+	_, body = serve(t, rt, "GET", "/static/")
+	assert.Equal(t, "file ", body)
+
+	res, _ := serve(t, rt, "GET", "/static")
+	assert.Equal(t, 404, res.StatusCode)
+}
+
+func TestRouter_DotSegments(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/static/{path...}", reply(func(req *request.Request) string {
+		return "file " + req.PathValue("path")
+	}))
+	rt.Handle("GET", "/users/{id}", reply(func(req *request.Request) string {
+		return "user " + req.PathValue("id")
+	}))
+
+	for _, target := range []string{
+		"/static/../../etc/passwd",
+		"/static/..%2F..%2Fetc%2Fpasswd",
+		"/static/%2e%2e/etc/passwd",
+		"/static/./site.css",
+		"/users/..",
+		"/users/a%2F..",
+	} {
+		res, _ := serve(t, rt, "GET", target)
+		assert.Equal(t, 404, res.StatusCode, target)
+	}
+
+	_, body := serve(t, rt, "GET", "/static/..site.css")
+	assert.Equal(t, "file ..site.css", body)
+}
+
+func TestRouter_LiteralBeatsParameter(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/{path...}", reply(func(*request.Request) string { return "catch-all" }))
+	rt.Handle("GET", "/users/{id}", reply(func(*request.Request) string { return "param" }))
+	rt.Handle("GET", "/users/me", reply(func(*request.Request) string { return "literal" }))
+
+	_, body := serve(t, rt, "GET", "/users/me")
+	assert.Equal(t, "literal", body)
+	_, body = serve(t, rt, "GET", "/users/you")
+	assert.Equal(t, "param", body)
+	_, body = serve(t, rt, "GET", "/other")
+	assert.Equal(t, "catch-all", body)
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/known", reply(func(*request.Request) string { return "ok" }))
+
+	res, body := serve(t, rt, "GET", "/unknown")
+	assert.Equal(t, 404, res.StatusCode)
+	assert.Equal(t, "404 page not found\n", body)
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	rt := New()
+	rt.Handle("POST", "/items/{id}", reply(func(*request.Request) string { return "post" }))
+	rt.Handle("DELETE", "/items/{id}", reply(func(*request.Request) string { return "delete" }))
+
+	res, _ := serve(t, rt, "GET", "/items/1")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "DELETE, OPTIONS, POST", res.Header.Get("Allow"))
+
+	_, body := serve(t, rt, "DELETE", "/items/1")
+	assert.Equal(t, "delete", body)
+}
+
+func TestRouter_HeadFallsBackToGet(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/video", reply(func(req *request.Request) string { return "get " + req.RequestLine.Method }))
+	rt.Handle("GET", "/files/{path...}", reply(func(*request.Request) string { return "get files" }))
+	rt.Handle("HEAD", "/files/{path...}", reply(func(*request.Request) string { return "head files" }))
+	rt.Handle("HEAD", "/{path...}", reply(func(*request.Request) string { return "head any" }))
+
+	_, body := serve(t, rt, "HEAD", "/video")
+	assert.Equal(t, "get HEAD", body)
+
+	_, body = serve(t, rt, "HEAD", "/files/a.txt")
+	assert.Equal(t, "head files", body)
+
+	_, body = serve(t, rt, "HEAD", "/other")
+	assert.Equal(t, "head any", body)
+
+	res, _ := serve(t, rt, "POST", "/video")
+	assert.Equal(t, 405, res.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+}
+
+func TestRouter_Options(t *testing.T) {
+	rt := New()
+	rt.Handle("GET", "/items/{id}", reply(func(*request.Request) string { return "get" }))
+	rt.Handle("PUT", "/items/{id}", reply(func(*request.Request) string { return "put" }))
+	rt.Handle("POST", "/upload", reply(func(*request.Request) string { return "upload" }))
+	rt.Handle("OPTIONS", "/upload", reply(func(*request.Request) string { return "custom options" }))
+
+	res, body := serve(t, rt, "OPTIONS", "/items/1")
+	assert.Equal(t, 204, res.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, PUT", res.Header.Get("Allow"))
+	assert.Empty(t, body)
+
+	_, body = serve(t, rt, "OPTIONS", "/upload")
+	assert.Equal(t, "custom options", body)
+
+	res, _ = serve(t, rt, "OPTIONS", "/missing")
+	assert.Equal(t, 404, res.StatusCode)
+
+	res, _ = serve(t, rt, "OPTIONS", "*")
+	assert.Equal(t, 204, res.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST, PUT", res.Header.Get("Allow"))
+}
+
+func TestRouter_BadPatterns(t *testing.T) {
+	for _, pattern := range []string{
+		"users",
+		"/users/{}",
+		"/users/{id",
+		"/files/{path...}/edit",
+		"/a/{id}/b/{id}",
+	} {
+		assert.Panics(t, func() { New().Handle("GET", pattern, nil) }, pattern)
+	}
+
+	rt := New()
+	rt.Handle("GET", "/twice", nil)
+	assert.Panics(t, func() { rt.Handle("GET", "/twice", nil) })
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Skorgum/httpfromtcp/internal/response"
+)
+
+// rejectTimeout and rejectDrain bound how long and how much a turned-away
+// client can keep sending while being told so, and maxRejecting how many are
+// being told at once; past that, connections are closed without an answer.
+const (
+	rejectTimeout = 5 * time.Second
+	rejectDrain   = 64 << 10
+	maxRejecting  = 64
+)
+
+var (
+	ErrTooManyConns      = errors.New("server: too many connections")
+	ErrTooManyConnsPerIP = errors.New("server: too many connections from client")
+)
+
+// Stats is a snapshot of the server's connection counters.
+type Stats struct {
+	Conns    int    // open connections
+	Active   int    // connections with a request in progress
+	Accepted uint64 // connections served since the server started
+	Rejected uint64 // connections turned away, with a 503 when possible
+}
+
+// Stats returns the current connection counters, for monitoring.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		Conns:    s.open,
+		Accepted: s.accepted.Load(),
+		Rejected: s.rejected.Load(),
+	}
+	for _, state := range s.conns {
+		if state == connActive {
+			stats.Active++
+		}
+	}
+	return stats
+}
+
+// admit checks conn against the connection limits and returns a function
+// that frees its place when it closes. queued means a slot was already taken
+// before accepting.
+func (s *Server) admit(conn net.Conn, queued bool) (release func(), err error) {
+	if s.slots != nil && !queued {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return nil, ErrTooManyConns
+		}
+	}
+
+	ip := clientIP(conn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxConnsPerIP > 0 && ip != "" && s.perIP[ip] >= s.maxConnsPerIP {
+		if s.slots != nil {
+			<-s.slots
+		}
+		return nil, ErrTooManyConnsPerIP
+	}
+	s.open++
+	if ip != "" {
+		s.perIP[ip]++
+	}
+
+	return func() {
+		s.mu.Lock()
+		s.open--
+		if ip != "" {
+			if s.perIP[ip]--; s.perIP[ip] == 0 {
+				delete(s.perIP, ip)
+			}
+		}
+		s.mu.Unlock()
+		if s.slots != nil {
+			<-s.slots
+		}
+	}, nil
+}
+
+// reject answers a connection the server has no room for with a 503, unless
+// too many are being answered already.
+func (s *Server) reject(conn net.Conn, err error) {
+	s.rejected.Add(1)
+	select {
+	case s.rejecting <- struct{}{}:
+	default:
+		conn.Close()
+		return
+	}
+
+	// tracked as idle so Close and Shutdown close it straight away
+	s.setConnState(conn, connIdle)
+	go func() {
+		defer func() { <-s.rejecting }()
+		defer s.forgetConn(conn)
+		defer conn.Close()
+		s.answerRejected(conn, err)
+	}()
+}
+
+func (s *Server) answerRejected(conn net.Conn, err error) {
+	conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+	w := response.NewWriter(conn)
+	if s.retryAfter > 0 {
+		secs := int(math.Ceil(s.retryAfter.Seconds()))
+		w.Header().Override("Retry-After", strconv.Itoa(secs))
+	}
+	s.writeError(w, response.StatusServiceUnavailable, err)
+
+	// closing with the request unread would reset the connection, possibly
+	// before the client reads the answer, so shut down our side and wait for
+	// the client to close theirs
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		io.Copy(io.Discard, io.LimitReader(conn, rejectDrain))
+	}
+}
+
+// clientIP returns the IP a connection comes from, or "" for connections that
+// have none, such as those over a Unix socket.
+func clientIP(conn net.Conn) string {
+	addr, ok := netConn(conn).RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return addr.IP.String()
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConns_Reject(t *testing.T) {
+	srv := startServer(t, echoTarget, WithMaxConns(1), WithRejectOverload(1500*time.Millisecond))
+
+	first := dial(t, srv)
+	assert.Equal(t, "/first", get(t, first, "/first"))
+
+	second := dial(t, srv)
+	_, err := io.WriteString(second, "GET /second HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, bufio.NewReader(second))
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+	assert.True(t, res.Close)
+
+	stats := srv.Stats()
+	assert.Equal(t, 1, stats.Conns)
+	assert.Equal(t, uint64(1), stats.Accepted)
+	assert.Equal(t, uint64(1), stats.Rejected)
+
+	first.Close()
+	require.Eventually(t, func() bool { return srv.Stats().Conns == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "/third", get(t, dial(t, srv), "/third"))
+}
+
+func TestMaxConns_Queue(t *testing.T) {
+	srv := startServer(t, echoTarget, WithMaxConns(1))
+
+	first := dial(t, srv)
+	assert.Equal(t, "/first", get(t, first, "/first"))
+
+	second := dial(t, srv)
+	_, err := io.WriteString(second, "GET /second HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	// not served while the first connection holds the only slot
+	second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	br := bufio.NewReader(second)
+	_, err = br.Peek(1)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	first.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, body := readResponse(t, br)
+	assert.Equal(t, "/second", body)
+	assert.Zero(t, srv.Stats().Rejected)
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	srv := startServer(t, echoTarget, WithMaxConnsPerIP(1))
+
+	first := dial(t, srv)
+	assert.Equal(t, "/first", get(t, first, "/first"))
+
+	second := dial(t, srv)
+	_, err := io.WriteString(second, "GET /second HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, bufio.NewReader(second))
+	assert.Equal(t, 503, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Retry-After"))
+
+	first.Close()
+	require.Eventually(t, func() bool { return srv.Stats().Conns == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "/again", get(t, dial(t, srv), "/again"))
+}
+
+func TestStats_Active(t *testing.T) {
+	release := make(chan struct{})
+	srv := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.Target.Path == "/block" {
+			<-release
+		}
+		echoTarget(w, req)
+	})
+
+	idle := dial(t, srv)
+	assert.Equal(t, "/idle", get(t, idle, "/idle"))
+
+	busy := dial(t, srv)
+	_, err := io.WriteString(busy, "GET /block HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return srv.Stats().Active == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, srv.Stats().Conns)
+
+	close(release)
+	_, body := readResponse(t, bufio.NewReader(busy))
+	assert.Equal(t, "/block", body)
+}
+
+func TestReject_ClosedByServerClose(t *testing.T) {
+	srv := startServer(t, echoTarget, WithMaxConns(1), WithRejectOverload(0))
+	first := dial(t, srv)
+	assert.Equal(t, "/first", get(t, first, "/first"))
+
+	// turned away, but never closes its side
+	second := dial(t, srv)
+	br := bufio.NewReader(second)
+	res, _ := readResponse(t, br)
+	assert.Equal(t, 503, res.StatusCode)
+
+	require.NoError(t, srv.Close())
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReject_Bounded(t *testing.T) {
+	srv := startServer(t, echoTarget, WithMaxConns(1), WithRejectOverload(0))
+	first := dial(t, srv)
+	assert.Equal(t, "/first", get(t, first, "/first"))
+
+	// each of these holds a reject slot until it closes
+	for range maxRejecting {
+		res, _ := readResponse(t, bufio.NewReader(dial(t, srv)))
+		assert.Equal(t, 503, res.StatusCode)
+	}
+
+	// past the bound the connection is simply closed
+	extra := dial(t, srv)
+	extra.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(extra)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+	assert.Equal(t, uint64(maxRejecting+1), srv.Stats().Rejected)
+}
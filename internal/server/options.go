@@ -0,0 +1,111 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Skorgum/httpfromtcp/internal/accesslog"
+	"github.com/Skorgum/httpfromtcp/internal/request"
+)
+
+type Option func(*Server)
+
+// WithReadHeaderTimeout bounds the time from the first byte of a request to
+// the end of its headers, and how long a new connection may wait before
+// sending its first request. Zero falls back to the read timeout.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithReadTimeout bounds the time from the first byte of a request to the
+// end of its body. Zero means no limit.
+func WithReadTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds the time from the end of the request headers to the
+// end of the response. Zero means no limit.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout bounds how long a keep-alive connection may wait for its
+// next request. Zero falls back to the read header timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.idleTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn closes a keep-alive connection after it has served
+// n requests. Zero or less means no limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(s *Server) {
+		s.maxRequestsPerConn = n
+	}
+}
+
+// WithLimits replaces request.DefaultLimits for requests read by the server.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithImmediateContinue sends 100 Continue as soon as a request asking for
+// it is parsed, instead of waiting for the handler to read the body. Handlers
+// then can't turn the upload away before it is sent.
+func WithImmediateContinue(immediate bool) Option {
+	return func(s *Server) {
+		s.immediateContinue = immediate
+	}
+}
+
+// WithErrorRenderer replaces DefaultErrorRenderer for the error responses the
+// server writes itself. The connection is closed after them.
+func WithErrorRenderer(fn ErrorRenderer) Option {
+	return func(s *Server) {
+		s.renderError = fn
+	}
+}
+
+// WithMaxConns caps the number of open connections. When the cap is reached
+// the server stops accepting until one closes, leaving new clients queued in
+// the listen backlog, unless WithRejectOverload is set.
+func WithMaxConns(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConnsPerIP caps the open connections from one client IP. Clients
+// over it are always rejected with 503, since queueing them would hold up
+// everyone else.
+func WithMaxConnsPerIP(n int) Option {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// WithRejectOverload answers connections over the WithMaxConns cap with
+// 503 Service Unavailable instead of queueing them. A non-zero retryAfter is
+// sent as Retry-After on every 503 for too many connections.
+func WithRejectOverload(retryAfter time.Duration) Option {
+	return func(s *Server) {
+		s.rejectOverload = true
+		s.retryAfter = retryAfter
+	}
+}
+
+// WithAccessLog records every request the server answers, including those it
+// rejects as malformed, once the response is complete.
+func WithAccessLog(l accesslog.Logger) Option {
+	return func(s *Server) {
+		s.accessLog = l
+	}
+}
@@ -1,74 +1,457 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/Skorgum/httpfromtcp/internal/accesslog"
+	"github.com/Skorgum/httpfromtcp/internal/headers"
 	"github.com/Skorgum/httpfromtcp/internal/request"
 	"github.com/Skorgum/httpfromtcp/internal/response"
 )
 
+const (
+	defaultReadHeaderTimeout  = 10 * time.Second
+	defaultIdleTimeout        = 2 * time.Minute
+	defaultMaxRequestsPerConn = 1000
+	shutdownPollInterval      = 10 * time.Millisecond
+)
+
+type connState int
+
+const (
+	connIdle connState = iota
+	connActive
+)
+
 type Handler func(w *response.Writer, req *request.Request)
 
+// ErrAbortHandler is a sentinel panic value that aborts a handler. The server
+// drops the connection without logging, so a response that has already
+// started goes out truncated instead of looking complete.
+var ErrAbortHandler = errors.New("server: abort handler")
+
+// ErrorRenderer writes the response for a request the server answers itself:
+// one it could not parse, or one whose handler failed before writing.
+type ErrorRenderer func(w *response.Writer, code response.StatusCode, err error)
+
 type Server struct {
-	listener net.Listener
-	handler  Handler
-	closed   atomic.Bool
+	listener           net.Listener
+	handler            Handler
+	closed             atomic.Bool
+	readHeaderTimeout  time.Duration
+	readTimeout        time.Duration
+	writeTimeout       time.Duration
+	idleTimeout        time.Duration
+	maxRequestsPerConn int
+	limits             request.Limits
+	renderError        ErrorRenderer
+	immediateContinue  bool
+	maxConns           int
+	maxConnsPerIP      int
+	rejectOverload     bool
+	retryAfter         time.Duration
+	accessLog          accesslog.Logger
+
+	// slots holds a token per open connection when maxConns is set
+	slots     chan struct{}
+	rejecting chan struct{}
+	done      chan struct{}
+	stopOnce  sync.Once
+	accepted  atomic.Uint64
+	rejected  atomic.Uint64
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+	open  int
+	perIP map[string]int
+}
+
+// Config says where a server listens.
+type Config struct {
+	Network string      // "tcp" (the default), "tcp4", "tcp6" or "unix"
+	Addr    string      // host:port, where an empty host means all interfaces, or a socket path
+	TLS     *tls.Config // serve HTTPS if set, as ServeTLS does
+}
+
+// Serve listens on port on all interfaces. Port 0 picks a free port, which
+// Addr reports.
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	return ServeConfig(Config{Addr: fmt.Sprintf(":%d", port)}, handler, opts...)
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// ServeConfig listens where cfg says, e.g. on localhost only or on a Unix
+// socket behind a proxy.
+func ServeConfig(cfg Config, handler Handler, opts ...Option) (*Server, error) {
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	var config *tls.Config
+	if cfg.TLS != nil {
+		var err error
+		if config, err = tlsConfig("", "", cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen(network, cfg.Addr)
 	if err != nil {
 		return nil, err
 	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	return ServeListener(listener, handler, opts...), nil
+}
 
+// ServeListener serves connections accepted from listener, which the server
+// closes on Close or Shutdown.
+func ServeListener(listener net.Listener, handler Handler, opts ...Option) *Server {
 	srv := &Server{
-		listener: listener,
-		handler:  handler,
+		listener:           listener,
+		handler:            handler,
+		readHeaderTimeout:  defaultReadHeaderTimeout,
+		idleTimeout:        defaultIdleTimeout,
+		maxRequestsPerConn: defaultMaxRequestsPerConn,
+		limits:             request.DefaultLimits,
+		renderError:        DefaultErrorRenderer,
+		done:               make(chan struct{}),
+		rejecting:          make(chan struct{}, maxRejecting),
+		conns:              make(map[net.Conn]connState),
+		perIP:              make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	if srv.maxConns > 0 {
+		srv.slots = make(chan struct{}, srv.maxConns)
 	}
 
 	go srv.listen()
 
-	return srv, nil
+	return srv
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
+// Close stops the server immediately, dropping every open connection.
 func (s *Server) Close() error {
+	err := s.stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests to
+// finish, closing connections as they go idle. If ctx expires first, the
+// remaining connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.stop()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop marks the server closed and stops accepting.
+func (s *Server) stop() error {
 	s.closed.Store(true)
-	if s.listener != nil {
-		return s.listener.Close()
+	s.stopOnce.Do(func() { close(s.done) })
+	return s.listener.Close()
+}
+
+// closeIdleConns closes connections that are between requests and reports
+// whether none are left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == connIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
 	}
-	return nil
+	return len(s.conns) == 0
+}
+
+func (s *Server) setConnState(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = state
+}
+
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
 }
 
 func (s *Server) listen() {
 	for {
+		// when full, stop accepting and let new clients wait in the backlog
+		queued := s.slots != nil && !s.rejectOverload
+		if queued {
+			select {
+			case s.slots <- struct{}{}:
+			case <-s.done:
+				return
+			}
+		}
+
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if queued {
+				<-s.slots
+			}
 			if s.closed.Load() {
 				return
 			}
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
-		go s.handle(conn)
+
+		release, err := s.admit(conn, queued)
+		if err != nil {
+			s.reject(conn, err)
+			continue
+		}
+		s.accepted.Add(1)
+		s.setConnState(conn, connIdle)
+		go func() {
+			defer release()
+			s.handle(conn)
+		}()
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	defer s.forgetConn(conn)
 	defer conn.Close()
 
-	w := response.NewWriter(conn)
+	reader := request.NewReader(conn)
+	reader.Limits = s.limits
 
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(response.StatusBadRequest)
-		body := []byte(fmt.Sprintf("Error parsing requst: %v", err))
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
+	for served := 1; !s.closed.Load(); served++ {
+		s.setConnState(conn, connIdle)
+		idle := s.idleTimeout
+		if served == 1 {
+			// only a keep-alive connection gets to sit idle; a new one
+			// must start its request within the header timeout
+			idle = 0
+		}
+		conn.SetReadDeadline(deadline(time.Now(), idle, s.readHeaderTimeout, s.readTimeout))
+		if err := reader.WaitForRequest(); err != nil {
+			return
+		}
+
+		s.setConnState(conn, connActive)
+		start := time.Now()
+		conn.SetReadDeadline(deadline(start, s.readHeaderTimeout, s.readTimeout))
+
+		req, err := reader.StreamRequest()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// the last request's write deadline has likely passed
+			conn.SetWriteDeadline(deadline(time.Now(), s.writeTimeout))
+			w := response.NewWriter(conn)
+			s.writeError(w, statusForError(err), err)
+			s.logAccess(conn, start, nil, w)
+			return
+		}
+		conn.SetReadDeadline(deadline(start, s.readTimeout))
+		conn.SetWriteDeadline(deadline(time.Now(), s.writeTimeout))
+
+		w := response.NewWriter(conn)
+		keepAlive := s.serve(conn, w, req, served)
+		s.logAccess(conn, start, req, w)
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+// serve answers one request and reports whether the connection can carry
+// another.
+func (s *Server) serve(conn net.Conn, w *response.Writer, req *request.Request, served int) bool {
+	if req.HTTP10() {
+		w.SetVersion("1.0")
+	}
+	w.SetOmitBody(req.RequestLine.Method == "HEAD")
+	w.SetKeepAlive(req.KeepAlive() && (s.maxRequestsPerConn <= 0 || served < s.maxRequestsPerConn))
+	w.OnWriteHeaders(func(*headers.Headers) {
+		// tell the client if a shutdown started while the handler ran,
+		// or if it's still holding back a body the handler didn't want
+		if s.closed.Load() || req.ExpectsContinue() {
+			w.SetKeepAlive(false)
+		}
+	})
+	req.OnContinue(func() error {
+		return w.WriteInformational(response.StatusContinue, nil)
+	})
+	if s.immediateContinue {
+		if err := req.Continue(); err != nil {
+			return false
+		}
+	}
+
+	if aborted := s.callHandler(w, req); aborted {
+		// a RST tells the client the response is truncated rather than
+		// letting a clean FIN pass it off as complete
+		if tcpConn, ok := netConn(conn).(*net.TCPConn); ok {
+			tcpConn.SetLinger(0)
+		}
+		return false
+	}
+
+	// a body that failed mid-stream, by breaking a limit or its framing,
+	// still gets an answer if the handler gave up without sending one;
+	// Finish would commit a 200
+	if err := req.BodyErr(); err != nil && w.Reset() {
+		w.SetKeepAlive(false)
+		s.writeError(w, statusForError(err), err)
+		return false
+	}
+
+	if err := w.Finish(); err != nil {
+		// e.g. a header value the handler copied from user input; if
+		// nothing went out yet the client still gets a clean answer
+		if w.Reset() {
+			w.SetKeepAlive(false)
+			s.writeError(w, response.StatusInternalServerError, err)
+		}
+		return false
+	}
+	if err := req.BodyReader().Close(); err != nil {
+		return false
+	}
+	return w.KeepAlive()
+}
+
+func (s *Server) logAccess(conn net.Conn, start time.Time, req *request.Request, w *response.Writer) {
+	if s.accessLog == nil {
 		return
 	}
 
+	e := accesslog.Entry{
+		Time:       start,
+		RemoteAddr: conn.RemoteAddr().String(),
+		Status:     int(w.StatusCode()),
+		Bytes:      w.BytesWritten(),
+		Duration:   time.Since(start),
+	}
+	if req != nil {
+		e.Method = req.RequestLine.Method
+		e.Target = req.RequestLine.RequestTarget
+		e.Proto = "HTTP/" + req.RequestLine.HttpVersion
+		e.UserAgent = req.Headers.Get("User-Agent")
+		e.Referer = req.Headers.Get("Referer")
+	}
+	s.accessLog.Log(e)
+}
+
+// deadline returns from plus the first non-zero timeout, or the zero time if
+// all of them are zero.
+func deadline(from time.Time, timeouts ...time.Duration) time.Time {
+	for _, d := range timeouts {
+		if d > 0 {
+			return from.Add(d)
+		}
+	}
+	return time.Time{}
+}
+
+// callHandler runs the handler, recovering from a panic. It reports whether
+// the response was left half-written and the connection must be aborted.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) (aborted bool) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		if rec == ErrAbortHandler {
+			aborted = true
+			return
+		}
+		log.Printf("panic serving %s %s: %v\n%s",
+			req.RequestLine.Method, req.RequestLine.RequestTarget, rec, debug.Stack())
+
+		if !w.Reset() {
+			aborted = true
+			return
+		}
+		w.SetKeepAlive(false)
+		s.writeError(w, response.StatusInternalServerError, fmt.Errorf("panic: %v", rec))
+	}()
+
 	s.handler(w, req)
+	return false
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrTimeout):
+		return response.StatusRequestTimeout
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ErrHeaderTooLarge):
+		return response.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusContentTooLarge
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return response.StatusNotImplemented
+	case errors.Is(err, request.ErrExpectationFailed):
+		return response.StatusExpectationFailed
+	default:
+		return response.StatusBadRequest
+	}
+}
+
+func (s *Server) writeError(w *response.Writer, code response.StatusCode, err error) {
+	s.renderError(w, code, err)
+	w.Finish()
+}
+
+// DefaultErrorRenderer replies with the reason phrase as plain text. The error
+// itself is left out, since it can echo request bytes or internal detail.
+func DefaultErrorRenderer(w *response.Writer, code response.StatusCode, err error) {
+	body := []byte(response.StatusText(code) + "\n")
+	w.WriteStatusLine(code)
+	h := response.GetDefaultHeaders(len(body))
+	h.Override("Content-Type", "text/plain")
+	w.WriteHeaders(h)
+	w.WriteBody(body)
 }
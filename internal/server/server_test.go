@@ -0,0 +1,715 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Skorgum/httpfromtcp/internal/accesslog"
+	"github.com/Skorgum/httpfromtcp/internal/request"
+	"github.com/Skorgum/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTarget(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func startServer(t *testing.T, handler Handler, opts ...Option) *Server {
+	t.Helper()
+	srv, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func dial(t *testing.T, srv *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readResponse(t *testing.T, br *bufio.Reader) (*http.Response, string) {
+	t.Helper()
+	res, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+	return res, string(body)
+}
+
+func TestServer_KeepAlive(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: x\r\n\r\nGET /two HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, body := readResponse(t, br)
+	assert.Equal(t, "/one", body)
+	assert.False(t, res.Close)
+
+	res, body = readResponse(t, br)
+	assert.Equal(t, "/two", body)
+	assert.False(t, res.Close)
+
+	_, err = io.WriteString(conn, "GET /three HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	res, body = readResponse(t, br)
+	assert.Equal(t, "/three", body)
+	assert.True(t, res.Close)
+
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_MaxRequestsPerConn(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithMaxRequestsPerConn(2)))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: x\r\n\r\nGET /two HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, br)
+	assert.False(t, res.Close)
+	res, _ = readResponse(t, br)
+	assert.True(t, res.Close)
+}
+
+func TestServer_MaxRequestsPerConnUnlimited(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithMaxRequestsPerConn(0)))
+	br := bufio.NewReader(conn)
+
+	for range 3 {
+		res, _ := readResponseFor(t, conn, br, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+		assert.False(t, res.Close)
+	}
+}
+
+func TestServer_StreamsRequestBody(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		data, err := io.ReadAll(req.BodyReader())
+		assert.NoError(t, err)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(data)))
+		w.WriteBody(data)
+	}))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "POST /echo HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nping\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	_, body := readResponse(t, br)
+	assert.Equal(t, "ping", body)
+}
+
+func TestServer_DrainsUnreadBody(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "POST /one HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhelloGET /two HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	_, body := readResponse(t, br)
+	assert.Equal(t, "/one", body)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "/two", body)
+}
+
+func TestServer_PanicBeforeStatusLine(t *testing.T) {
+	srv := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.Target.Path == "/panic" {
+			panic("boom")
+		}
+		echoTarget(w, req)
+	})
+
+	conn := dial(t, srv)
+	_, err := io.WriteString(conn, "GET /panic HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 500, res.StatusCode)
+	assert.True(t, res.Close)
+
+	// the server is still up
+	conn = dial(t, srv)
+	_, err = io.WriteString(conn, "GET /fine HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	_, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "/fine", body)
+}
+
+func TestServer_PanicAfterStatusLineAbortsConnection(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(100))
+		w.WriteBody([]byte("partial"))
+		panic("boom")
+	}))
+
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	_, err = io.ReadAll(res.Body)
+	assert.Error(t, err)
+}
+
+func TestServer_ErrAbortHandlerAbortsConnection(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 5000))
+		panic(ErrAbortHandler)
+	}))
+
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	_, err = io.ReadAll(res.Body)
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownWaitsForActiveRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.Target.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		echoTarget(w, req)
+	})
+
+	idle := dial(t, srv)
+	_, err := io.WriteString(idle, "GET /fast HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	idleReader := bufio.NewReader(idle)
+	readResponse(t, idleReader)
+
+	busy := dial(t, srv)
+	_, err = io.WriteString(busy, "GET /slow HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	done := make(chan error)
+	go func() { done <- srv.Shutdown(context.Background()) }()
+
+	// the idle keep-alive connection is closed right away
+	_, err = idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while a request was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	res, body := readResponse(t, bufio.NewReader(busy))
+	assert.Equal(t, "/slow", body)
+	assert.True(t, res.Close)
+	assert.NoError(t, <-done)
+
+	_, err = net.Dial("tcp", srv.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownContextExpires(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := startServer(t, func(w *response.Writer, req *request.Request) {
+		<-release
+	})
+
+	conn := dial(t, srv)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.conns[findConn(srv)] == connActive && len(srv.conns) == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, srv.Shutdown(ctx), context.DeadlineExceeded)
+
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.Error(t, err)
+}
+
+// findConn returns any tracked connection; callers hold srv.mu.
+func findConn(srv *Server) net.Conn {
+	for conn := range srv.conns {
+		return conn
+	}
+	return nil
+}
+
+func TestServer_ReadHeaderTimeout(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithReadHeaderTimeout(50*time.Millisecond)))
+
+	// a slowloris client: headers trickle in and never finish
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 408, res.StatusCode)
+	assert.True(t, res.Close)
+}
+
+func TestServer_SilentConnectionUsesReadHeaderTimeout(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithReadHeaderTimeout(50*time.Millisecond)))
+
+	// the idle timeout only applies between requests, so a client that
+	// connects and sends nothing is dropped after the header timeout
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithIdleTimeout(50*time.Millisecond)))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	readResponse(t, br)
+
+	// an idle connection is closed without a response
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_ErrorAfterWriteTimeoutElapsed(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget, WithWriteTimeout(100*time.Millisecond)))
+	br := bufio.NewReader(conn)
+
+	_, body := readResponseFor(t, conn, br, "GET /one HTTP/1.1\r\nHost: x\r\n\r\n")
+	assert.Equal(t, "/one", body)
+
+	// well past the first request's write deadline
+	time.Sleep(300 * time.Millisecond)
+	res, _ := readResponseFor(t, conn, br, "BROKEN\r\n\r\n")
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func readResponseFor(t *testing.T, conn net.Conn, br *bufio.Reader, raw string) (*http.Response, string) {
+	t.Helper()
+	_, err := io.WriteString(conn, raw)
+	require.NoError(t, err)
+	return readResponse(t, br)
+}
+
+func TestServer_ErrorStatusCodes(t *testing.T) {
+	srv := startServer(t, echoTarget, WithLimits(request.Limits{
+		MaxRequestLine: 64,
+		MaxHeaderLine:  64,
+		MaxHeaderCount: 5,
+		MaxBodySize:    16,
+	}))
+
+	for _, tc := range []struct {
+		raw  string
+		code int
+	}{
+		{"GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\n\r\n", 414},
+		{"GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("b", 100) + "\r\n\r\n", 431},
+		{"GET / HTTP/1.1\r\n" + strings.Repeat("X-A: b\r\n", 6) + "\r\n", 431},
+		{"POST / HTTP/1.1\r\nContent-Length: 17\r\n\r\n", 413},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n20\r\n" + strings.Repeat("c", 32) + "\r\n0\r\n\r\n", 413},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n", 501},
+		{"GET / HTTP/2.0\r\n\r\n", 505},
+		{"GET / HTTP/1.1 extra\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 1\r\n\r\n0\r\n\r\n", 400},
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab", 400},
+	} {
+		conn := dial(t, srv)
+		_, err := io.WriteString(conn, tc.raw)
+		require.NoError(t, err)
+
+		res, _ := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, tc.code, res.StatusCode, tc.raw)
+		assert.True(t, res.Close)
+	}
+}
+
+func TestServer_FinishesWriterResponses(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Override("Content-Type", "text/plain")
+		io.WriteString(w, "written ")
+		io.WriteString(w, req.Target.Path)
+	}))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: x\r\n\r\nGET /two HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, body := readResponse(t, br)
+	assert.Equal(t, "written /one", body)
+	assert.Equal(t, int64(12), res.ContentLength)
+	assert.False(t, res.Close)
+
+	_, body = readResponse(t, br)
+	assert.Equal(t, "written /two", body)
+}
+
+func TestServer_RejectsHeaderInjection(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Override("X-Echo", req.Target.Query.Get("v"))
+		io.WriteString(w, "ok")
+	}))
+
+	_, err := io.WriteString(conn, "GET /?v=a%0d%0aSet-Cookie:%20evil=1 HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 500, res.StatusCode)
+	assert.Empty(t, res.Header.Values("Set-Cookie"))
+	assert.True(t, res.Close)
+}
+
+func TestServer_DefaultErrorPage(t *testing.T) {
+	conn := dial(t, startServer(t, echoTarget))
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nX-Secret\x00: <script>\r\n\r\n")
+	require.NoError(t, err)
+
+	res, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 400, res.StatusCode)
+	assert.Equal(t, "Bad Request\n", body)
+}
+
+func TestServer_ErrorRenderer(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := startServer(t, echoTarget, WithErrorRenderer(func(w *response.Writer, code response.StatusCode, err error) {
+		errs <- err
+		w.SetStatus(code)
+		w.Header().Override("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status":%d}`, code)
+	}))
+
+	conn := dial(t, srv)
+	_, err := io.WriteString(conn, "GET / HTTP/3.0\r\n\r\n")
+	require.NoError(t, err)
+
+	res, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 505, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, `{"status":505}`, body)
+	assert.True(t, res.Close)
+	assert.ErrorIs(t, <-errs, request.ErrUnsupportedVersion)
+}
+
+func TestServer_HTTP10(t *testing.T) {
+	srv := startServer(t, echoTarget)
+
+	conn := dial(t, srv)
+	_, err := io.WriteString(conn, "GET /old HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	res, body := readResponse(t, br)
+	assert.Equal(t, "HTTP/1.0", res.Proto)
+	assert.Equal(t, "/old", body)
+	assert.True(t, res.Close)
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	conn = dial(t, srv)
+	br = bufio.NewReader(conn)
+	_, err = io.WriteString(conn, "GET /one HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	require.NoError(t, err)
+	res, body = readResponse(t, br)
+	assert.Equal(t, "/one", body)
+	assert.Equal(t, "keep-alive", res.Header.Get("Connection"))
+
+	_, err = io.WriteString(conn, "GET /two HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	require.NoError(t, err)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "/two", body)
+}
+
+func TestServer_HTTP10StreamedBody(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		for range 3 {
+			io.WriteString(w, strings.Repeat("z", 2000))
+		}
+	}))
+
+	_, err := io.WriteString(conn, "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	require.NoError(t, err)
+	res, body := readResponse(t, bufio.NewReader(conn))
+	assert.Empty(t, res.TransferEncoding)
+	assert.Equal(t, int64(-1), res.ContentLength)
+	assert.Len(t, body, 6000)
+	assert.True(t, res.Close)
+}
+
+func TestServer_HeadOmitsBody(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		w.Header().Override("Content-Type", "text/plain")
+		io.WriteString(w, "hello from "+req.RequestLine.Method)
+	}))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "HEAD / HTTP/1.1\r\nHost: x\r\n\r\nGET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	res, err := http.ReadResponse(br, &http.Request{Method: "HEAD"})
+	require.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, int64(len("hello from HEAD")), res.ContentLength)
+	assert.Equal(t, "text/plain", res.Header.Get("Content-Type"))
+	assert.False(t, res.Close)
+
+	// the next response starts right after the HEAD headers
+	_, body := readResponse(t, br)
+	assert.Equal(t, "hello from GET", body)
+}
+
+func echoBody(w *response.Writer, req *request.Request) {
+	body, err := io.ReadAll(req.BodyReader())
+	if err != nil {
+		return
+	}
+	w.Write(body)
+}
+
+func TestServer_ExpectContinue(t *testing.T) {
+	conn := dial(t, startServer(t, echoBody))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, br)
+	assert.Equal(t, 100, res.StatusCode)
+
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "hello", body)
+	assert.False(t, res.Close)
+}
+
+func TestServer_ExpectContinueRejected(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.ExpectsContinue() && req.Headers.Get("Content-Length") != "1" {
+			w.SetStatus(response.StatusContentTooLarge)
+			io.WriteString(w, "too big")
+			return
+		}
+		echoBody(w, req)
+	}))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 1000000\r\n\r\n")
+	require.NoError(t, err)
+
+	// the final status comes first, and the unsent body can't be skipped
+	res, body := readResponse(t, br)
+	assert.Equal(t, 413, res.StatusCode)
+	assert.Equal(t, "too big", body)
+	assert.True(t, res.Close)
+}
+
+func TestServer_ExpectContinueImmediately(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		io.WriteString(w, "ignored the body")
+	}, WithImmediateContinue(true)))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n")
+	require.NoError(t, err)
+	res, _ := readResponse(t, br)
+	assert.Equal(t, 100, res.StatusCode)
+
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	res, body := readResponse(t, br)
+	assert.Equal(t, "ignored the body", body)
+	assert.False(t, res.Close)
+}
+
+func TestServer_ExpectationFailed(t *testing.T) {
+	conn := dial(t, startServer(t, echoBody))
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nExpect: something-else\r\nContent-Length: 1\r\n\r\nx")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 417, res.StatusCode)
+}
+
+func get(t *testing.T, conn net.Conn, target string) string {
+	t.Helper()
+	_, err := io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+	_, body := readResponse(t, bufio.NewReader(conn))
+	return body
+}
+
+func TestServeConfig_BindAddress(t *testing.T) {
+	srv, err := ServeConfig(Config{Addr: "127.0.0.1:0"}, echoTarget)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	addr, ok := srv.Addr().(*net.TCPAddr)
+	require.True(t, ok)
+	assert.True(t, addr.IP.IsLoopback())
+	assert.NotZero(t, addr.Port)
+
+	assert.Equal(t, "/local", get(t, dial(t, srv), "/local"))
+}
+
+func TestServeConfig_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "http.sock")
+	srv, err := ServeConfig(Config{Network: "unix", Addr: path}, echoTarget)
+	require.NoError(t, err)
+	assert.Equal(t, path, srv.Addr().String())
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "/over/unix", get(t, conn, "/over/unix"))
+
+	require.NoError(t, srv.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file removed on Close")
+}
+
+func TestServeListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := ServeListener(listener, echoTarget)
+	assert.Equal(t, listener.Addr(), srv.Addr())
+	assert.Equal(t, "/mine", get(t, dial(t, srv), "/mine"))
+
+	require.NoError(t, srv.Close())
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err)
+}
+
+type entryLog chan accesslog.Entry
+
+func (l entryLog) Log(e accesslog.Entry) {
+	l <- e
+}
+
+func TestServer_AccessLog(t *testing.T) {
+	entries := make(entryLog, 10)
+	conn := dial(t, startServer(t, echoTarget, WithAccessLog(entries)))
+	br := bufio.NewReader(conn)
+
+	_, err := io.WriteString(conn, "GET /logged?x=1 HTTP/1.1\r\nHost: x\r\nUser-Agent: test/1.0\r\nReferer: /from\r\n\r\n")
+	require.NoError(t, err)
+	readResponse(t, br)
+
+	e := <-entries
+	assert.Equal(t, "GET", e.Method)
+	assert.Equal(t, "/logged?x=1", e.Target)
+	assert.Equal(t, "HTTP/1.1", e.Proto)
+	assert.Equal(t, 200, e.Status)
+	assert.Equal(t, len("/logged?x=1"), e.Bytes)
+	assert.Equal(t, "test/1.0", e.UserAgent)
+	assert.Equal(t, "/from", e.Referer)
+	assert.Equal(t, conn.LocalAddr().String(), e.RemoteAddr)
+	assert.False(t, e.Time.IsZero())
+
+	_, err = io.WriteString(conn, "BROKEN\r\n\r\n")
+	require.NoError(t, err)
+	readResponse(t, br)
+
+	e = <-entries
+	assert.Equal(t, 400, e.Status)
+	assert.Empty(t, e.Method)
+}
+
+func TestServer_MalformedFieldLines(t *testing.T) {
+	srv := startServer(t, echoTarget)
+
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\nfoo\r\n\r\n",
+		"GET / HTTP/1.1\r\n: x\r\n\r\n",
+		"POST / HTTP/1.1\r\n Content-Length: 3\r\n\r\nabc",
+	} {
+		conn := dial(t, srv)
+		_, err := io.WriteString(conn, raw)
+		require.NoError(t, err)
+
+		res, _ := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, 400, res.StatusCode, raw)
+		assert.True(t, res.Close)
+	}
+
+	// still serving
+	assert.Equal(t, "/alive", get(t, dial(t, srv), "/alive"))
+}
+
+func TestServer_BodyTooLargeMidStream(t *testing.T) {
+	conn := dial(t, startServer(t, func(w *response.Writer, req *request.Request) {
+		// the handler gives up on the error without answering
+		io.ReadAll(req.BodyReader())
+	}, WithLimits(request.Limits{MaxBodySize: 16})))
+
+	_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = io.WriteString(conn, "20\r\n"+strings.Repeat("c", 32)+"\r\n0\r\n\r\n")
+	require.NoError(t, err)
+
+	res, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 413, res.StatusCode)
+	assert.True(t, res.Close)
+}
+
+func TestServer_MalformedBodyMidStream(t *testing.T) {
+	handler := func(w *response.Writer, req *request.Request) {
+		io.ReadAll(req.BodyReader())
+	}
+
+	t.Run("bad chunk size", func(t *testing.T) {
+		conn := dial(t, startServer(t, handler))
+		_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n")
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		_, err = io.WriteString(conn, "zz\r\n")
+		require.NoError(t, err)
+
+		res, _ := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, 400, res.StatusCode)
+		assert.True(t, res.Close)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		conn := dial(t, startServer(t, handler))
+		_, err := io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\nhello")
+		require.NoError(t, err)
+		conn.(*net.TCPConn).CloseWrite()
+
+		res, _ := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, 400, res.StatusCode)
+		assert.True(t, res.Close)
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ServeTLS is Serve over HTTPS. The certificate and key are loaded from
+// certFile and keyFile; both may be empty if config already supplies
+// Certificates or GetCertificate. config may be nil.
+//
+// With several certificates in config, the one matching the client's SNI
+// server name is chosen. ALPN advertises http/1.1, the only protocol spoken.
+func ServeTLS(port int, certFile, keyFile string, config *tls.Config, handler Handler, opts ...Option) (*Server, error) {
+	config, err := tlsConfig(certFile, keyFile, config)
+	if err != nil {
+		return nil, err
+	}
+	return ServeConfig(Config{Addr: fmt.Sprintf(":%d", port), TLS: config}, handler, opts...)
+}
+
+func tlsConfig(certFile, keyFile string, config *tls.Config) (*tls.Config, error) {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("server: TLS needs a certificate")
+	}
+
+	// offering anything else, h2 in particular, would let a client pick a
+	// protocol the server can't speak
+	config.NextProtos = []string{"http/1.1"}
+	return config, nil
+}
+
+// netConn unwraps a TLS connection to the socket underneath.
+func netConn(conn net.Conn) net.Conn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		return tlsConn.NetConn()
+	}
+	return conn
+}
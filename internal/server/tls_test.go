@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selfSigned makes a throwaway certificate for the given DNS names.
+func selfSigned(t *testing.T, names ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: names[0]},
+		DNSNames:              names,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func dialTLS(t *testing.T, srv *Server, serverName string, roots ...tls.Certificate) *tls.Conn {
+	t.Helper()
+	pool := x509.NewCertPool()
+	for _, cert := range roots {
+		pool.AddCert(cert.Leaf)
+	}
+	conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{
+		ServerName: serverName,
+		RootCAs:    pool,
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServeTLS_CertFiles(t *testing.T) {
+	cert := selfSigned(t, "localhost")
+	certFile, keyFile := writePEM(t, cert)
+
+	srv, err := ServeTLS(0, certFile, keyFile, nil, echoTarget)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	conn := dialTLS(t, srv, "localhost", cert)
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+
+	br := bufio.NewReader(conn)
+	for _, target := range []string{"/one", "/two"} {
+		_, err = io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		_, body := readResponse(t, br)
+		assert.Equal(t, target, body)
+	}
+}
+
+func TestServeTLS_SNI(t *testing.T) {
+	a := selfSigned(t, "a.example")
+	b := selfSigned(t, "b.example")
+
+	srv, err := ServeTLS(0, "", "", &tls.Config{Certificates: []tls.Certificate{a, b}}, echoTarget)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	for name, cert := range map[string]tls.Certificate{"a.example": a, "b.example": b} {
+		conn := dialTLS(t, srv, name, a, b)
+		peer := conn.ConnectionState().PeerCertificates[0]
+		assert.Equal(t, cert.Leaf.Raw, peer.Raw, name)
+
+		_, err = io.WriteString(conn, "GET /"+name+" HTTP/1.1\r\nHost: "+name+"\r\n\r\n")
+		require.NoError(t, err)
+		_, body := readResponse(t, bufio.NewReader(conn))
+		assert.Equal(t, "/"+name, body)
+	}
+}
+
+func TestServeTLS_RequiresCertificate(t *testing.T) {
+	_, err := ServeTLS(0, "", "", nil, echoTarget)
+	assert.Error(t, err)
+
+	_, err = ServeTLS(0, "missing.pem", "missing.key", nil, echoTarget)
+	assert.Error(t, err)
+}
+
+func TestServeTLS_PlainClientIsDropped(t *testing.T) {
+	srv, err := ServeTLS(0, "", "", &tls.Config{Certificates: []tls.Certificate{selfSigned(t, "localhost")}}, echoTarget)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, _ := io.ReadAll(conn)
+	assert.NotContains(t, string(data), "HTTP/1.1 200")
+}
+
+func TestServeConfig_TLS(t *testing.T) {
+	cert := selfSigned(t, "localhost")
+	srv, err := ServeConfig(Config{
+		Addr: "127.0.0.1:0",
+		TLS:  &tls.Config{Certificates: []tls.Certificate{cert}},
+	}, echoTarget)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	conn := dialTLS(t, srv, "localhost", cert)
+	assert.Equal(t, "http/1.1", conn.ConnectionState().NegotiatedProtocol)
+	assert.Equal(t, "/secure", get(t, conn, "/secure"))
+}